@@ -0,0 +1,137 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/docker/machine/libmachine/log"
+	"github.com/vmware/go-vcloud-director/v2/govcd"
+)
+
+// serviceAccountTokenType is a token_type of the service account token file
+const serviceAccountTokenType = "Service Account"
+
+// authenticate logs in to vCloud Director with API token, token file or username and password.
+// It returns expiration time of the session
+func (c *VCloudClient) authenticate() (time.Time, error) {
+	switch {
+	case c.cfg.APIToken != "":
+		log.Infof("NewVCloudClient.authenticate using API token for org: %s", c.cfg.Org)
+
+		tokenRefresh, err := c.Client.SetApiToken(c.cfg.Org, c.cfg.APIToken)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("NewVCloudClient.authenticate.SetApiToken error: %w", err)
+		}
+
+		return c.tokenExpiration(tokenRefresh.ExpiresIn), nil
+	case c.cfg.TokenFile != "":
+		log.Infof("NewVCloudClient.authenticate using token file %s for org: %s", c.cfg.TokenFile, c.cfg.Org)
+
+		return c.authenticateWithTokenFile()
+	default:
+		if err := c.Client.Authenticate(c.cfg.UserName, c.cfg.UserPassword, c.cfg.Org); err != nil {
+			return time.Time{}, fmt.Errorf("NewVCloudClient.authenticate.Authenticate error: %w", err)
+		}
+	}
+
+	return c.tokenExpiration(0), nil
+}
+
+// tokenExpiration returns expiration time of the bearer token. Login with password doesn't
+// report it, so SessionTTL is used. Tokens are never trusted longer than SessionTTL
+func (c *VCloudClient) tokenExpiration(expiresIn int) time.Time {
+	ttl := c.cfg.SessionTTL
+	if ttl <= 0 {
+		ttl = defaultSessionTTL
+	}
+
+	if expiresIn > 0 && time.Duration(expiresIn)*time.Second < ttl {
+		ttl = time.Duration(expiresIn) * time.Second
+	}
+
+	return time.Now().Add(ttl)
+}
+
+// authenticateWithTokenFile logs in with the token stored in TokenFile.
+// The file holds either a plain API token or a service account JSON document:
+//
+//	{"token_type": "Service Account", "refresh_token": "..."}
+//
+// Service account refresh tokens are rotated on every use, so the new refresh token
+// is written back to the file
+func (c *VCloudClient) authenticateWithTokenFile() (time.Time, error) {
+	content, err := os.ReadFile(c.cfg.TokenFile)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("NewVCloudClient.authenticateWithTokenFile.ReadFile error: %w", err)
+	}
+
+	trimmed := strings.TrimSpace(string(content))
+	if trimmed == "" {
+		return time.Time{}, fmt.Errorf("NewVCloudClient.authenticateWithTokenFile token file %s is empty", c.cfg.TokenFile)
+	}
+
+	// plain API token
+	if !strings.HasPrefix(trimmed, "{") {
+		tokenRefresh, err := c.Client.SetApiToken(c.cfg.Org, trimmed)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("NewVCloudClient.authenticateWithTokenFile.SetApiToken error: %w", err)
+		}
+
+		return c.tokenExpiration(tokenRefresh.ExpiresIn), nil
+	}
+
+	tokenFile := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(trimmed), &tokenFile); err != nil {
+		return time.Time{}, fmt.Errorf("NewVCloudClient.authenticateWithTokenFile.Unmarshal error: %w", err)
+	}
+
+	refreshToken, _ := tokenFile["refresh_token"].(string)
+	if refreshToken == "" {
+		return time.Time{}, fmt.Errorf("NewVCloudClient.authenticateWithTokenFile token file %s has no refresh_token", c.cfg.TokenFile)
+	}
+
+	tokenRefresh, err := c.Client.GetBearerTokenFromApiToken(c.cfg.Org, refreshToken)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("NewVCloudClient.authenticateWithTokenFile.GetBearerTokenFromApiToken error: %w", err)
+	}
+
+	if err := c.Client.SetToken(c.cfg.Org, govcd.BearerTokenHeader, tokenRefresh.AccessToken); err != nil {
+		return time.Time{}, fmt.Errorf("NewVCloudClient.authenticateWithTokenFile.SetToken error: %w", err)
+	}
+
+	// API tokens are not rotated, service account tokens are
+	expiration := c.tokenExpiration(tokenRefresh.ExpiresIn)
+
+	newRefreshToken, _ := tokenRefresh.RefreshToken.(string)
+	if newRefreshToken == "" || newRefreshToken == refreshToken {
+		return expiration, nil
+	}
+
+	log.Infof("NewVCloudClient.authenticateWithTokenFile save rotated service account token to %s", c.cfg.TokenFile)
+
+	tokenFile["refresh_token"] = newRefreshToken
+	tokenFile["updated_on"] = time.Now().Format(time.RFC3339)
+	if _, ok := tokenFile["token_type"]; !ok {
+		tokenFile["token_type"] = serviceAccountTokenType
+	}
+
+	updated, err := json.MarshalIndent(tokenFile, "", "  ")
+	if err != nil {
+		return time.Time{}, fmt.Errorf("NewVCloudClient.authenticateWithTokenFile.MarshalIndent error: %w", err)
+	}
+
+	// old refresh token is not valid anymore, so replace the file atomically
+	tmpFile := c.cfg.TokenFile + ".tmp"
+	if err := os.WriteFile(tmpFile, updated, 0600); err != nil {
+		return time.Time{}, fmt.Errorf("NewVCloudClient.authenticateWithTokenFile.WriteFile error: %w", err)
+	}
+
+	if err := os.Rename(tmpFile, c.cfg.TokenFile); err != nil {
+		return time.Time{}, fmt.Errorf("NewVCloudClient.authenticateWithTokenFile.Rename error: %w", err)
+	}
+
+	return expiration, nil
+}
@@ -0,0 +1,224 @@
+package client
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/machine/libmachine/log"
+	"github.com/vmware/go-vcloud-director/v2/govcd"
+	"github.com/vmware/go-vcloud-director/v2/types/v56"
+)
+
+// catalog item selection of vcd-catalogitem-latest
+const (
+	CatalogItemLatestCreated = "created"
+	CatalogItemLatestVersion = "version"
+)
+
+// catalogItemRegexPrefix marks vcd-catalogitem-match value as a regular expression, otherwise it's a glob
+const catalogItemRegexPrefix = "regex:"
+
+var versionNumberPattern = regexp.MustCompile(`\d+`)
+
+// CatalogItemMatcher matches catalog item names by glob or regular expression
+type CatalogItemMatcher struct {
+	pattern string
+	regex   *regexp.Regexp
+}
+
+// ParseCatalogItemMatch parses vcd-catalogitem-match value: glob or regular expression with regex: prefix
+func ParseCatalogItemMatch(pattern string) (*CatalogItemMatcher, error) {
+	if strings.HasPrefix(pattern, catalogItemRegexPrefix) {
+		regex, err := regexp.Compile(strings.TrimPrefix(pattern, catalogItemRegexPrefix))
+		if err != nil {
+			return nil, fmt.Errorf("invalid vcd-catalogitem-match %q: %w", pattern, err)
+		}
+
+		return &CatalogItemMatcher{pattern: pattern, regex: regex}, nil
+	}
+
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid vcd-catalogitem-match %q: %w", pattern, err)
+	}
+
+	return &CatalogItemMatcher{pattern: pattern}, nil
+}
+
+// Match reports whether catalog item name matches the whole pattern
+func (m *CatalogItemMatcher) Match(name string) bool {
+	if m.regex == nil {
+		matched, _ := path.Match(m.pattern, name)
+		return matched
+	}
+
+	loc := m.regex.FindStringIndex(name)
+
+	return loc != nil && loc[0] == 0 && loc[1] == len(name)
+}
+
+// version returns version of catalog item name: the first group of the regular expression if it has one,
+// otherwise all numbers of the name
+func (m *CatalogItemMatcher) version(name string) []int {
+	source := name
+	if m.regex != nil && m.regex.NumSubexp() > 0 {
+		if groups := m.regex.FindStringSubmatch(name); len(groups) > 1 {
+			source = groups[1]
+		}
+	}
+
+	numbers := versionNumberPattern.FindAllString(source, -1)
+	version := make([]int, 0, len(numbers))
+	for _, number := range numbers {
+		value, err := strconv.Atoi(number)
+		if err != nil {
+			continue
+		}
+
+		version = append(version, value)
+	}
+
+	return version
+}
+
+// compareVersions compares versions component by component, missing components are lower
+func compareVersions(a, b []int) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			if a[i] < b[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	return len(a) - len(b)
+}
+
+// findCatalogItem resolves catalog item of the config by ID, by match pattern or by name
+func (c *VCloudClient) findCatalogItem(catalog *govcd.Catalog) (*govcd.CatalogItem, error) {
+	switch {
+	case c.cfg.CatalogItemID != "":
+		log.Infof("buildInstance Finding Catalog item with id %s", c.cfg.CatalogItemID)
+
+		return catalog.GetCatalogItemById(c.cfg.CatalogItemID, true)
+	case c.cfg.CatalogItemMatch != "":
+		log.Infof("buildInstance Finding latest Catalog item by %s matching %s", c.cfg.CatalogItemLatest, c.cfg.CatalogItemMatch)
+
+		return findLatestCatalogItem(catalog, c.cfg.CatalogItemMatch, c.cfg.CatalogItemLatest)
+	default:
+		log.Infof("buildInstance Finding Catalog item %s", c.cfg.CatalogItem)
+
+		return catalog.GetCatalogItemByName(c.cfg.CatalogItem, true)
+	}
+}
+
+// findLatestCatalogItem returns the newest catalog item matching the pattern by creation date or by version in its name
+func findLatestCatalogItem(catalog *govcd.Catalog, pattern, latest string) (*govcd.CatalogItem, error) {
+	matcher, err := ParseCatalogItemMatch(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := catalog.Refresh(); err != nil {
+		return nil, fmt.Errorf("findLatestCatalogItem.Refresh error: %w", err)
+	}
+
+	candidates := matchCatalogItems(matcher, catalog.Catalog.CatalogItems)
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no catalog item in catalog %s matches %s", catalog.Catalog.Name, pattern)
+	}
+
+	if latest == CatalogItemLatestVersion {
+		candidate := latestVersionItem(matcher, candidates)
+
+		log.Infof("findLatestCatalogItem selected %s of %d matching items", candidate.Name, len(candidates))
+
+		return catalog.GetCatalogItemByHref(candidate.HREF)
+	}
+
+	var (
+		newest     *govcd.CatalogItem
+		newestDate time.Time
+	)
+
+	for _, candidate := range candidates {
+		item, errItem := catalog.GetCatalogItemByHref(candidate.HREF)
+		if errItem != nil {
+			return nil, fmt.Errorf("findLatestCatalogItem.GetCatalogItemByHref %s error: %w", candidate.Name, errItem)
+		}
+
+		created, errDate := time.Parse(time.RFC3339, item.CatalogItem.DateCreated)
+		if errDate != nil {
+			log.Warnf("findLatestCatalogItem skips %s with invalid creation date %q", candidate.Name, item.CatalogItem.DateCreated)
+			continue
+		}
+
+		if newest == nil || created.After(newestDate) {
+			newest = item
+			newestDate = created
+		}
+	}
+
+	if newest == nil {
+		return nil, fmt.Errorf("no catalog item matching %s has a creation date", pattern)
+	}
+
+	log.Infof("findLatestCatalogItem selected %s created at %s of %d matching items", newest.CatalogItem.Name, newestDate, len(candidates))
+
+	return newest, nil
+}
+
+// matchCatalogItems returns catalog items whose names match
+func matchCatalogItems(matcher *CatalogItemMatcher, catalogItems []*types.CatalogItems) []*types.Reference {
+	candidates := make([]*types.Reference, 0)
+
+	for _, items := range catalogItems {
+		for _, item := range items.CatalogItem {
+			if matcher.Match(item.Name) {
+				candidates = append(candidates, item)
+			}
+		}
+	}
+
+	return candidates
+}
+
+// latestVersionItem returns the candidate with the highest version, the first one of equal versions
+func latestVersionItem(matcher *CatalogItemMatcher, candidates []*types.Reference) *types.Reference {
+	sorted := append([]*types.Reference(nil), candidates...)
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return compareVersions(matcher.version(sorted[i].Name), matcher.version(sorted[j].Name)) > 0
+	})
+
+	return sorted[0]
+}
+
+// findTemplateVM returns VM of the vApp template by name, the first VM if name is empty.
+// The error lists names of template VMs
+func findTemplateVM(vAppTemplate *govcd.VAppTemplate, name string) (*types.VAppTemplate, error) {
+	if vAppTemplate.VAppTemplate.Children == nil || len(vAppTemplate.VAppTemplate.Children.VM) == 0 {
+		return nil, fmt.Errorf("vApp template %s has no VMs", vAppTemplate.VAppTemplate.Name)
+	}
+
+	vms := vAppTemplate.VAppTemplate.Children.VM
+	if name == "" {
+		return vms[0], nil
+	}
+
+	names := make([]string, 0, len(vms))
+	for _, vm := range vms {
+		if vm.Name == name {
+			return vm, nil
+		}
+
+		names = append(names, vm.Name)
+	}
+
+	return nil, fmt.Errorf("vApp template %s has no VM %s, available VMs: %s", vAppTemplate.VAppTemplate.Name, name, strings.Join(names, ", "))
+}
@@ -0,0 +1,149 @@
+package client
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/vmware/go-vcloud-director/v2/types/v56"
+)
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b []int
+		want int
+	}{
+		{a: []int{1, 10}, b: []int{1, 9}, want: 1},
+		{a: []int{1, 9}, b: []int{1, 10}, want: -1},
+		{a: []int{2}, b: []int{1, 99, 99}, want: 1},
+		{a: []int{1, 2}, b: []int{1, 2}, want: 0},
+		{a: []int{1, 2, 1}, b: []int{1, 2}, want: 1},
+		{a: []int{1, 2}, b: []int{1, 2, 0}, want: -1},
+		{a: nil, b: []int{0}, want: -1},
+		{a: nil, b: nil, want: 0},
+	}
+
+	for _, test := range tests {
+		got := compareVersions(test.a, test.b)
+		if sign(got) != test.want {
+			t.Errorf("compareVersions(%v, %v) = %d, want sign %d", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func sign(value int) int {
+	switch {
+	case value > 0:
+		return 1
+	case value < 0:
+		return -1
+	}
+
+	return 0
+}
+
+func TestCatalogItemMatcher(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		match   bool
+		version []int
+	}{
+		{pattern: "ubuntu-22.04-docker-*", name: "ubuntu-22.04-docker-20240105", match: true, version: []int{22, 4, 20240105}},
+		{pattern: "ubuntu-22.04-docker-*", name: "ubuntu-20.04-docker-20240105"},
+		{pattern: "ubuntu-22.04-docker-?", name: "ubuntu-22.04-docker-10"},
+		{pattern: "ubuntu-*", name: "debian-ubuntu-1"},
+		{pattern: "regex:app-(\\d+\\.\\d+)-.*", name: "app-1.10-rc2", match: true, version: []int{1, 10}},
+		{pattern: "regex:app-\\d+", name: "app-12", match: true, version: []int{12}},
+		{pattern: "regex:app-\\d+", name: "app-12-old"},
+		{pattern: "regex:app-\\d+", name: "my-app-12"},
+		{pattern: "regex:app-(\\d+)|other", name: "other", match: true, version: []int{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.pattern+" "+test.name, func(t *testing.T) {
+			matcher, err := ParseCatalogItemMatch(test.pattern)
+			if err != nil {
+				t.Fatalf("ParseCatalogItemMatch error: %v", err)
+			}
+
+			if got := matcher.Match(test.name); got != test.match {
+				t.Fatalf("Match = %v, want %v", got, test.match)
+			}
+
+			if !test.match {
+				return
+			}
+
+			if got := matcher.version(test.name); !reflect.DeepEqual(got, test.version) {
+				t.Errorf("version = %v, want %v", got, test.version)
+			}
+		})
+	}
+
+	for _, pattern := range []string{"ubuntu-[", "regex:app-(\\d+"} {
+		if _, err := ParseCatalogItemMatch(pattern); err == nil {
+			t.Errorf("ParseCatalogItemMatch(%q) error expected", pattern)
+		}
+	}
+}
+
+func TestLatestVersionItem(t *testing.T) {
+	catalogItems := func(names ...string) []*types.CatalogItems {
+		items := &types.CatalogItems{}
+		for _, name := range names {
+			items.CatalogItem = append(items.CatalogItem, &types.Reference{Name: name, HREF: "https://vcd/" + name})
+		}
+
+		return []*types.CatalogItems{items}
+	}
+
+	tests := []struct {
+		name    string
+		pattern string
+		items   []*types.CatalogItems
+		want    string
+	}{
+		{
+			name:    "numeric not lexical order",
+			pattern: "app-*",
+			items:   catalogItems("app-1.9", "app-1.10", "app-1.2", "other-9.9"),
+			want:    "app-1.10",
+		},
+		{
+			name:    "longer version is newer",
+			pattern: "app-*",
+			items:   catalogItems("app-1.10", "app-1.10.1", "app-1.9.9"),
+			want:    "app-1.10.1",
+		},
+		{
+			name:    "regex group ignores suffix numbers",
+			pattern: "regex:app-(\\d+\\.\\d+)-.*",
+			items:   catalogItems("app-1.9-build99", "app-1.10-build1", "app-1.10-build2"),
+			want:    "app-1.10-build1",
+		},
+		{
+			name:    "date suffix",
+			pattern: "ubuntu-22.04-docker-*",
+			items:   catalogItems("ubuntu-22.04-docker-20231201", "ubuntu-22.04-docker-20240105", "ubuntu-22.04-docker-20240101"),
+			want:    "ubuntu-22.04-docker-20240105",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			matcher, err := ParseCatalogItemMatch(test.pattern)
+			if err != nil {
+				t.Fatalf("ParseCatalogItemMatch error: %v", err)
+			}
+
+			candidates := matchCatalogItems(matcher, test.items)
+			if len(candidates) == 0 {
+				t.Fatal("no matching catalog items")
+			}
+
+			if got := latestVersionItem(matcher, candidates); got.Name != test.want {
+				t.Errorf("latestVersionItem = %s, want %s", got.Name, test.want)
+			}
+		})
+	}
+}
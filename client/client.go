@@ -2,6 +2,7 @@ package client
 
 import (
 	"net/url"
+	"time"
 
 	"github.com/docker/machine/libmachine/log"
 	"github.com/vmware/go-vcloud-director/v2/govcd"
@@ -12,16 +13,34 @@ type ConfigClient struct {
 	MachineName             string
 	UserName                string
 	UserPassword            string
+	APIToken                string
+	TokenFile               string
 	Org                     string
 	VDC                     string
 	OrgVDCNet               string
 	Catalog                 string
 	CatalogItem             string
+	CatalogItemID           string
+	CatalogItemMatch        string
+	CatalogItemLatest       string
+	TemplateVM              string
+	TemplateSource          string
 	StorProfile             string
 	AdapterType             string
 	IPAddressAllocationMode string
+	IPAddress               string
+	Networks                []NetworkConfig
+	PrimaryNIC              int
+	SizingPolicy            string
+	PlacementPolicy         string
 	Url                     *url.URL
 	Insecure                bool
+	CACert                  string
+	TLSFingerprint          string
+	ProxyURL                *url.URL
+	NoProxy                 string
+	SessionCacheDir         string
+	SessionTTL              time.Duration
 }
 
 type VCloudClient struct {
@@ -31,8 +50,14 @@ type VCloudClient struct {
 	Org               *govcd.Org
 	StorageProfileRef types.Reference
 	VAppTemplate      govcd.VAppTemplate
+	TemplateVM        *types.VAppTemplate
 	Network           *govcd.OrgVDCNetwork
+	Networks          []*govcd.OrgVDCNetwork
 	CatalogItem       *govcd.CatalogItem
+	SizingPolicy      *types.VdcComputePolicy
+	PlacementPolicy   *types.VdcComputePolicy
+	sessions          *sessionCache
+	loggingIn         bool
 }
 
 func NewVCloudClient(cfg ConfigClient) (*VCloudClient, error) {
@@ -41,13 +66,30 @@ func NewVCloudClient(cfg ConfigClient) (*VCloudClient, error) {
 	// creates a new VCDClient with params
 	client := govcd.NewVCDClient(*cfg.Url, cfg.Insecure)
 
+	if errTLS := configureTLS(client, cfg); errTLS != nil {
+		log.Errorf("NewVCloudClient.configureTLS error: %v", errTLS)
+		return nil, errTLS
+	}
+
+	if errProxy := configureProxy(client, cfg); errProxy != nil {
+		log.Errorf("NewVCloudClient.configureProxy error: %v", errProxy)
+		return nil, errProxy
+	}
+
 	vcdClient := &VCloudClient{
-		cfg:    cfg,
-		Client: client,
+		cfg:      cfg,
+		Client:   client,
+		sessions: newSessionCache(cfg),
+	}
+
+	// expired sessions are refreshed transparently
+	client.Client.Http.Transport = &reauthTransport{
+		base:   client.Client.Http.Transport,
+		client: vcdClient,
 	}
 
-	// Authenticate to vCloud Director
-	errAuth := vcdClient.Client.Authenticate(cfg.UserName, cfg.UserPassword, cfg.Org)
+	// Authenticate to vCloud Director or reuse cached session
+	errAuth := vcdClient.login("")
 	if errAuth != nil {
 		log.Errorf("NewVCloudClient.Authenticate error: %v", errAuth)
 		return nil, errAuth
@@ -55,7 +97,7 @@ func NewVCloudClient(cfg ConfigClient) (*VCloudClient, error) {
 
 	// Prepare vdc application
 	org, errOrg := vcdClient.Client.GetOrgByName(cfg.Org)
-	if errAuth != nil {
+	if errOrg != nil {
 		log.Errorf("buildInstance.GetOrgById error: %v", errOrg)
 		return nil, errOrg
 	}
@@ -79,6 +121,36 @@ func (c *VCloudClient) BuildInstance() error {
 		return errVdc
 	}
 
+	if c.cfg.IPAddress != "" {
+		log.Infof("buildInstance validating IP address %s on network %s", c.cfg.IPAddress, c.cfg.OrgVDCNet)
+
+		if errIP := c.validateIPAddress(network, c.cfg.IPAddress, c.cfg.IPAddressAllocationMode); errIP != nil {
+			log.Errorf("buildInstance.validateIPAddress error: %v", errIP)
+			return errIP
+		}
+	}
+
+	networks := []*govcd.OrgVDCNetwork{network}
+
+	for _, networkCfg := range c.cfg.Networks {
+		additional, errNet := c.VirtualDataCenter.GetOrgVdcNetworkByName(networkCfg.Name, true)
+		if errNet != nil {
+			log.Errorf("buildInstance.GetOrgVdcNetworkByName %s error: %v", networkCfg.Name, errNet)
+			return errNet
+		}
+
+		if networkCfg.IPAddress != "" {
+			log.Infof("buildInstance validating IP address %s on network %s", networkCfg.IPAddress, networkCfg.Name)
+
+			if errIP := c.validateIPAddress(additional, networkCfg.IPAddress, networkCfg.AllocationMode); errIP != nil {
+				log.Errorf("buildInstance.validateIPAddress error: %v", errIP)
+				return errIP
+			}
+		}
+
+		networks = append(networks, additional)
+	}
+
 	log.Infof("buildInstance Finding Catalog: %s", c.cfg.Catalog)
 
 	catalog, errCat := c.Org.GetCatalogByName(c.cfg.Catalog, true)
@@ -87,14 +159,14 @@ func (c *VCloudClient) BuildInstance() error {
 		return errCat
 	}
 
-	log.Infof("buildInstance Finding Catalog item %s", c.cfg.CatalogItem)
-
-	catalogItem, errItem := catalog.GetCatalogItemByName(c.cfg.CatalogItem, true)
+	catalogItem, errItem := c.ensureCatalogItem(catalog)
 	if errItem != nil {
-		log.Errorf("buildInstance.GetCatalogItemByName error: %v", errItem)
+		log.Errorf("buildInstance.ensureCatalogItem error: %v", errItem)
 		return errItem
 	}
 
+	log.Infof("buildInstance using Catalog item %s with id %s", catalogItem.CatalogItem.Name, catalogItem.CatalogItem.ID)
+
 	// Get StorageProfileReference
 	storageProfileRef, errProf := c.VirtualDataCenter.FindStorageProfileReference(c.cfg.StorProfile)
 	if errProf != nil {
@@ -102,30 +174,82 @@ func (c *VCloudClient) BuildInstance() error {
 		return errProf
 	}
 
+	if errPolicy := c.buildComputePolicies(); errPolicy != nil {
+		log.Errorf("buildInstance.buildComputePolicies error: %v", errPolicy)
+		return errPolicy
+	}
+
 	vAppTemplate, err := catalogItem.GetVAppTemplate()
 	if err != nil {
 		log.Errorf("buildInstance.GetVAppTemplate error: %v", err)
 		return err
 	}
 
-	vAppTemplate.VAppTemplate.Children.VM[0].Name = c.cfg.MachineName
+	templateVM, err := findTemplateVM(&vAppTemplate, c.cfg.TemplateVM)
+	if err != nil {
+		log.Errorf("buildInstance.findTemplateVM error: %v", err)
+		return err
+	}
+
+	log.Infof("buildInstance using template VM %s", templateVM.Name)
+
+	templateVM.Name = c.cfg.MachineName
 
 	log.Infof("Create.postSettingsVM change network to %s...", c.cfg.AdapterType)
 
-	vAppTemplate.VAppTemplate.Children.VM[0].NetworkConnectionSection.NetworkConnection[0] =
-		&types.NetworkConnection{
-			Network:                 c.cfg.OrgVDCNet,
-			NetworkAdapterType:      c.cfg.AdapterType,
-			IPAddressAllocationMode: c.cfg.IPAddressAllocationMode,
-			NetworkConnectionIndex:  0,
+	if templateVM.NetworkConnectionSection == nil {
+		templateVM.NetworkConnectionSection = &types.NetworkConnectionSection{}
+	}
+
+	networkSection := templateVM.NetworkConnectionSection
+
+	primary := &types.NetworkConnection{
+		Network:                 c.cfg.OrgVDCNet,
+		NetworkAdapterType:      c.cfg.AdapterType,
+		IPAddressAllocationMode: c.cfg.IPAddressAllocationMode,
+		IPAddress:               c.cfg.IPAddress,
+		NetworkConnectionIndex:  0,
+		IsConnected:             true,
+		NeedsCustomization:      true,
+	}
+
+	if len(networkSection.NetworkConnection) == 0 {
+		networkSection.NetworkConnection = append(networkSection.NetworkConnection, primary)
+	} else {
+		networkSection.NetworkConnection[0] = primary
+	}
+
+	// additional NICs replace NICs of the template with the same index
+	for i, networkCfg := range c.cfg.Networks {
+		index := i + 1
+
+		log.Infof("buildInstance NIC %d connected to network %s", index, networkCfg.Name)
+
+		connection := &types.NetworkConnection{
+			Network:                 networkCfg.Name,
+			NetworkAdapterType:      networkCfg.AdapterType,
+			IPAddressAllocationMode: networkCfg.AllocationMode,
+			IPAddress:               networkCfg.IPAddress,
+			NetworkConnectionIndex:  index,
 			IsConnected:             true,
 			NeedsCustomization:      true,
 		}
 
+		if index < len(networkSection.NetworkConnection) {
+			networkSection.NetworkConnection[index] = connection
+		} else {
+			networkSection.NetworkConnection = append(networkSection.NetworkConnection, connection)
+		}
+	}
+
+	networkSection.PrimaryNetworkConnectionIndex = c.cfg.PrimaryNIC
+
 	c.VAppTemplate = vAppTemplate
+	c.TemplateVM = templateVM
 	c.StorageProfileRef = storageProfileRef
 	c.CatalogItem = catalogItem
 	c.Network = network
+	c.Networks = networks
 
 	return nil
 }
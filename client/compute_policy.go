@@ -0,0 +1,85 @@
+package client
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/docker/machine/libmachine/log"
+	"github.com/vmware/go-vcloud-director/v2/types/v56"
+)
+
+// vdcComputePoliciesAPIVersion is a minimal API version of VDC assigned compute policies endpoint
+const vdcComputePoliciesAPIVersion = "33.0"
+
+// getAssignedComputePolicies returns compute policies assigned to the VDC.
+// The endpoint is available to tenant users, unlike the admin VDC view
+func (c *VCloudClient) getAssignedComputePolicies() ([]*types.VdcComputePolicy, error) {
+	urlRef, err := c.Client.Client.OpenApiBuildEndpoint(
+		types.OpenApiPathVersion1_0_0,
+		fmt.Sprintf(types.OpenApiEndpointVdcAssignedComputePolicies, c.VirtualDataCenter.Vdc.ID),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("getAssignedComputePolicies.OpenApiBuildEndpoint error: %w", err)
+	}
+
+	policies := []*types.VdcComputePolicy{{}}
+
+	err = c.Client.Client.OpenApiGetAllItems(vdcComputePoliciesAPIVersion, urlRef, nil, &policies, nil)
+	if err != nil {
+		return nil, fmt.Errorf("getAssignedComputePolicies of VDC %s error: %w", c.VirtualDataCenter.Vdc.Name, err)
+	}
+
+	return policies, nil
+}
+
+// findComputePolicy returns compute policy assigned to the VDC by name.
+// The error lists names of assigned policies, kind is used in messages only
+func findComputePolicy(policies []*types.VdcComputePolicy, name, kind string) (*types.VdcComputePolicy, error) {
+	names := make([]string, 0, len(policies))
+
+	for _, policy := range policies {
+		if policy.Name == name {
+			log.Infof("findComputePolicy found %s policy %s with id %s", kind, name, policy.ID)
+			return policy, nil
+		}
+
+		names = append(names, policy.Name)
+	}
+
+	sort.Strings(names)
+
+	return nil, fmt.Errorf("%s policy %s is not assigned to the VDC, available policies: %s", kind, name, strings.Join(names, ", "))
+}
+
+// buildComputePolicies resolves sizing and placement policies of the config
+func (c *VCloudClient) buildComputePolicies() error {
+	if c.cfg.SizingPolicy == "" && c.cfg.PlacementPolicy == "" {
+		return nil
+	}
+
+	policies, err := c.getAssignedComputePolicies()
+	if err != nil {
+		return err
+	}
+
+	if c.cfg.SizingPolicy != "" {
+		sizing, errSizing := findComputePolicy(policies, c.cfg.SizingPolicy, "sizing")
+		if errSizing != nil {
+			return errSizing
+		}
+
+		c.SizingPolicy = sizing
+	}
+
+	if c.cfg.PlacementPolicy != "" {
+		placement, errPlacement := findComputePolicy(policies, c.cfg.PlacementPolicy, "placement")
+		if errPlacement != nil {
+			return errPlacement
+		}
+
+		c.PlacementPolicy = placement
+	}
+
+	return nil
+}
@@ -0,0 +1,228 @@
+package client
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/docker/machine/libmachine/log"
+	"github.com/vmware/go-vcloud-director/v2/govcd"
+	"github.com/vmware/go-vcloud-director/v2/types/v56"
+)
+
+// allocatedIPAddresses is a response of org VDC network allocatedAddresses endpoint
+type allocatedIPAddresses struct {
+	XMLName   xml.Name `xml:"AllocatedIpAddresses"`
+	IPAddress []struct {
+		AllocationType string `xml:"allocationType,attr"`
+		IPAddress      string `xml:"IpAddress"`
+	} `xml:"IpAddress"`
+}
+
+// NetworkConfig is an additional NIC of the VM, NIC 0 is configured with OrgVDCNet of ConfigClient
+type NetworkConfig struct {
+	Name           string
+	AdapterType    string
+	AllocationMode string
+	IPAddress      string
+}
+
+// ParseNetworkSpec parses vcd-network value name[:adapter[:allocation[:ip]]].
+// Allocation mode is DHCP by default and MANUAL if only IP address is set
+func ParseNetworkSpec(spec string) (NetworkConfig, error) {
+	parts := strings.SplitN(spec, ":", 4)
+
+	network := NetworkConfig{
+		Name: strings.TrimSpace(parts[0]),
+	}
+
+	if network.Name == "" {
+		return NetworkConfig{}, fmt.Errorf("invalid vcd-network %q: network name is empty", spec)
+	}
+
+	if len(parts) > 1 {
+		network.AdapterType = strings.TrimSpace(parts[1])
+	}
+
+	if len(parts) > 2 {
+		network.AllocationMode = strings.ToUpper(strings.TrimSpace(parts[2]))
+	}
+
+	if len(parts) > 3 {
+		network.IPAddress = strings.TrimSpace(parts[3])
+
+		if network.IPAddress != "" && net.ParseIP(network.IPAddress) == nil {
+			return NetworkConfig{}, fmt.Errorf("invalid vcd-network %q: invalid IP address %q", spec, network.IPAddress)
+		}
+	}
+
+	switch network.AllocationMode {
+	case "":
+		network.AllocationMode = types.IPAllocationModeDHCP
+		if network.IPAddress != "" {
+			network.AllocationMode = types.IPAllocationModeManual
+		}
+	case types.IPAllocationModeDHCP, types.IPAllocationModeNone:
+		if network.IPAddress != "" {
+			return NetworkConfig{}, fmt.Errorf("invalid vcd-network %q: IP address requires %s or %s allocation mode",
+				spec, types.IPAllocationModeManual, types.IPAllocationModePool)
+		}
+	case types.IPAllocationModeManual:
+		if network.IPAddress == "" {
+			return NetworkConfig{}, fmt.Errorf("invalid vcd-network %q: %s allocation mode requires IP address", spec, types.IPAllocationModeManual)
+		}
+	case types.IPAllocationModePool:
+	default:
+		return NetworkConfig{}, fmt.Errorf("invalid vcd-network %q: unknown allocation mode %s", spec, network.AllocationMode)
+	}
+
+	return network, nil
+}
+
+// validateIPAddress checks that ipAddress belongs to subnet of the network, fits allocation mode
+// and is not used on the network yet
+func (c *VCloudClient) validateIPAddress(network *govcd.OrgVDCNetwork, ipAddress, allocationMode string) error {
+	ip, err := checkIPAddressScope(network.OrgVDCNetwork, ipAddress, allocationMode)
+	if err != nil {
+		return err
+	}
+
+	allocated, err := c.getAllocatedIPAddresses(network)
+	if err != nil {
+		return err
+	}
+
+	for _, allocatedIP := range allocated {
+		if ip.Equal(net.ParseIP(allocatedIP)) {
+			return fmt.Errorf("IP address %s is already in use on network %s", ipAddress, network.OrgVDCNetwork.Name)
+		}
+	}
+
+	return nil
+}
+
+// checkIPAddressScope checks that ipAddress belongs to a subnet of the network, isn't its gateway
+// and fits static pool of the allocation mode
+func checkIPAddressScope(network *types.OrgVDCNetwork, ipAddress, allocationMode string) (net.IP, error) {
+	ip := net.ParseIP(ipAddress)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP address %q", ipAddress)
+	}
+
+	if network.Configuration == nil || network.Configuration.IPScopes == nil {
+		return nil, fmt.Errorf("network %s has no IP scopes to validate IP address %s", network.Name, ipAddress)
+	}
+
+	var (
+		scope   *types.IPScope
+		subnets []string
+	)
+
+	for _, ipScope := range network.Configuration.IPScopes.IPScope {
+		subnet := scopeSubnet(ipScope)
+		if subnet == nil {
+			continue
+		}
+
+		subnets = append(subnets, subnet.String())
+
+		if subnet.Contains(ip) {
+			scope = ipScope
+			break
+		}
+	}
+
+	if scope == nil {
+		return nil, fmt.Errorf("IP address %s is out of network %s subnets: %s", ipAddress, network.Name, strings.Join(subnets, ", "))
+	}
+
+	if ip.Equal(net.ParseIP(scope.Gateway)) {
+		return nil, fmt.Errorf("IP address %s is a gateway of network %s", ipAddress, network.Name)
+	}
+
+	inPool := scopeStaticPoolContains(scope, ip)
+
+	switch {
+	case allocationMode == types.IPAllocationModePool && !inPool:
+		return nil, fmt.Errorf("IP address %s is out of static pool of network %s, use %s allocation mode", ipAddress, network.Name, types.IPAllocationModeManual)
+	case allocationMode == types.IPAllocationModeManual && inPool:
+		log.Warnf("validateIPAddress IP address %s is in static pool of network %s and could be allocated to another VM", ipAddress, network.Name)
+	}
+
+	return ip, nil
+}
+
+// getAllocatedIPAddresses returns IP addresses which are in use on the network
+func (c *VCloudClient) getAllocatedIPAddresses(network *govcd.OrgVDCNetwork) ([]string, error) {
+	addresses := make([]string, 0)
+
+	for _, ipScope := range network.OrgVDCNetwork.Configuration.IPScopes.IPScope {
+		if ipScope.AllocatedIPAddresses != nil {
+			addresses = append(addresses, ipScope.AllocatedIPAddresses.IPAddress...)
+		}
+	}
+
+	var allocated allocatedIPAddresses
+
+	_, err := c.Client.Client.ExecuteRequest(
+		network.OrgVDCNetwork.HREF+"/allocatedAddresses",
+		http.MethodGet,
+		"",
+		"error retrieving allocated IP addresses: %s",
+		nil,
+		&allocated,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("getAllocatedIPAddresses of network %s error: %w", network.OrgVDCNetwork.Name, err)
+	}
+
+	for _, address := range allocated.IPAddress {
+		addresses = append(addresses, address.IPAddress)
+	}
+
+	return addresses, nil
+}
+
+func scopeSubnet(ipScope *types.IPScope) *net.IPNet {
+	gateway := net.ParseIP(ipScope.Gateway)
+	mask := net.ParseIP(ipScope.Netmask)
+	if gateway == nil || mask == nil {
+		return nil
+	}
+
+	var ipMask net.IPMask
+	if mask4 := mask.To4(); mask4 != nil && gateway.To4() != nil {
+		ipMask = net.IPMask(mask4)
+		gateway = gateway.To4()
+	} else {
+		ipMask = net.IPMask(mask.To16())
+	}
+
+	return &net.IPNet{
+		IP:   gateway.Mask(ipMask),
+		Mask: ipMask,
+	}
+}
+
+func scopeStaticPoolContains(ipScope *types.IPScope, ip net.IP) bool {
+	if ipScope.IPRanges == nil {
+		return false
+	}
+
+	for _, ipRange := range ipScope.IPRanges.IPRange {
+		start := net.ParseIP(ipRange.StartAddress)
+		end := net.ParseIP(ipRange.EndAddress)
+		if start == nil || end == nil {
+			continue
+		}
+
+		if bytes.Compare(ip.To16(), start.To16()) >= 0 && bytes.Compare(ip.To16(), end.To16()) <= 0 {
+			return true
+		}
+	}
+
+	return false
+}
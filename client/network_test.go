@@ -0,0 +1,109 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/vmware/go-vcloud-director/v2/types/v56"
+)
+
+func TestParseNetworkSpec(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    NetworkConfig
+		invalid bool
+	}{
+		{spec: "storage", want: NetworkConfig{Name: "storage", AllocationMode: types.IPAllocationModeDHCP}},
+		{spec: " storage : VMXNET3 ", want: NetworkConfig{Name: "storage", AdapterType: "VMXNET3", AllocationMode: types.IPAllocationModeDHCP}},
+		{spec: "storage:VMXNET3:pool", want: NetworkConfig{Name: "storage", AdapterType: "VMXNET3", AllocationMode: types.IPAllocationModePool}},
+		{spec: "storage:::10.0.1.15", want: NetworkConfig{Name: "storage", AllocationMode: types.IPAllocationModeManual, IPAddress: "10.0.1.15"}},
+		{spec: "storage:VMXNET3:MANUAL:10.0.1.15", want: NetworkConfig{Name: "storage", AdapterType: "VMXNET3", AllocationMode: types.IPAllocationModeManual, IPAddress: "10.0.1.15"}},
+		{spec: "storage::POOL:10.0.1.15", want: NetworkConfig{Name: "storage", AllocationMode: types.IPAllocationModePool, IPAddress: "10.0.1.15"}},
+		{spec: "storage::NONE", want: NetworkConfig{Name: "storage", AllocationMode: types.IPAllocationModeNone}},
+		{spec: "", invalid: true},
+		{spec: " :VMXNET3", invalid: true},
+		{spec: "storage::MANUAL", invalid: true},
+		{spec: "storage::DHCP:10.0.1.15", invalid: true},
+		{spec: "storage::NONE:10.0.1.15", invalid: true},
+		{spec: "storage::STATIC", invalid: true},
+		{spec: "storage:::10.0.1.300", invalid: true},
+		{spec: "storage:::host.example.com", invalid: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.spec, func(t *testing.T) {
+			network, err := ParseNetworkSpec(test.spec)
+			if test.invalid {
+				if err == nil {
+					t.Fatalf("ParseNetworkSpec error expected, got %+v", network)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("ParseNetworkSpec error: %v", err)
+			}
+
+			if network != test.want {
+				t.Errorf("ParseNetworkSpec = %+v, want %+v", network, test.want)
+			}
+		})
+	}
+}
+
+func TestCheckIPAddressScope(t *testing.T) {
+	network := &types.OrgVDCNetwork{
+		Name: "net",
+		Configuration: &types.NetworkConfiguration{
+			IPScopes: &types.IPScopes{IPScope: []*types.IPScope{
+				{
+					Gateway: "10.0.1.1",
+					Netmask: "255.255.255.0",
+					IPRanges: &types.IPRanges{IPRange: []*types.IPRange{
+						{StartAddress: "10.0.1.100", EndAddress: "10.0.1.199"},
+					}},
+				},
+				{
+					Gateway: "192.168.8.1",
+					Netmask: "255.255.252.0",
+				},
+			}},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		ip      string
+		mode    string
+		invalid bool
+	}{
+		{name: "manual outside pool", ip: "10.0.1.15", mode: types.IPAllocationModeManual},
+		{name: "manual inside pool", ip: "10.0.1.150", mode: types.IPAllocationModeManual},
+		{name: "pool inside pool", ip: "10.0.1.100", mode: types.IPAllocationModePool},
+		{name: "pool range end", ip: "10.0.1.199", mode: types.IPAllocationModePool},
+		{name: "second scope", ip: "192.168.11.254", mode: types.IPAllocationModeManual},
+		{name: "pool outside pool", ip: "10.0.1.200", mode: types.IPAllocationModePool, invalid: true},
+		{name: "gateway", ip: "10.0.1.1", mode: types.IPAllocationModeManual, invalid: true},
+		{name: "second scope gateway", ip: "192.168.8.1", mode: types.IPAllocationModeManual, invalid: true},
+		{name: "out of subnet", ip: "10.0.2.15", mode: types.IPAllocationModeManual, invalid: true},
+		{name: "out of second subnet", ip: "192.168.12.1", mode: types.IPAllocationModeManual, invalid: true},
+		{name: "malformed", ip: "10.0.1", mode: types.IPAllocationModeManual, invalid: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := checkIPAddressScope(network, test.ip, test.mode)
+			if test.invalid && err == nil {
+				t.Fatal("checkIPAddressScope error expected")
+			}
+
+			if !test.invalid && err != nil {
+				t.Fatalf("checkIPAddressScope error: %v", err)
+			}
+		})
+	}
+
+	if _, err := checkIPAddressScope(&types.OrgVDCNetwork{Name: "empty"}, "10.0.1.15", types.IPAllocationModeManual); err == nil {
+		t.Error("checkIPAddressScope error expected for network without IP scopes")
+	}
+}
@@ -0,0 +1,120 @@
+package client
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/docker/machine/libmachine/log"
+	"github.com/vmware/go-vcloud-director/v2/govcd"
+)
+
+// supported proxy schemes, credentials are taken from URL user info
+var proxySchemes = map[string]interface{}{
+	"http":   nil,
+	"https":  nil,
+	"socks5": nil,
+}
+
+// ValidateProxyURL checks scheme and host of the proxy URL
+func ValidateProxyURL(proxyURL *url.URL) error {
+	if _, ok := proxySchemes[proxyURL.Scheme]; !ok {
+		return fmt.Errorf("unsupported proxy scheme %q, expected http, https or socks5", proxyURL.Scheme)
+	}
+
+	if proxyURL.Host == "" {
+		return fmt.Errorf("proxy URL %s has no host", proxyURL.Redacted())
+	}
+
+	return nil
+}
+
+// configureProxy applies proxy to the HTTP transport of govcd client for all API calls
+func configureProxy(vcdClient *govcd.VCDClient, cfg ConfigClient) error {
+	if cfg.ProxyURL == nil {
+		return nil
+	}
+
+	if err := ValidateProxyURL(cfg.ProxyURL); err != nil {
+		return err
+	}
+
+	transport, ok := vcdClient.Client.Http.Transport.(*http.Transport)
+	if !ok {
+		return fmt.Errorf("configureProxy unexpected transport type: %T", vcdClient.Client.Http.Transport)
+	}
+
+	log.Infof("configureProxy using proxy %s, no proxy: %s", cfg.ProxyURL.Redacted(), cfg.NoProxy)
+
+	proxyURL := cfg.ProxyURL
+	noProxy := parseNoProxy(cfg.NoProxy)
+
+	transport.Proxy = func(req *http.Request) (*url.URL, error) {
+		if noProxy.match(req.URL.Hostname()) {
+			return nil, nil
+		}
+
+		return proxyURL, nil
+	}
+
+	return nil
+}
+
+// noProxyList is a list of hosts, domains (.example.com), IPs and CIDRs which are reached directly
+type noProxyList struct {
+	all      bool
+	hosts    []string
+	networks []*net.IPNet
+}
+
+func parseNoProxy(noProxy string) noProxyList {
+	var list noProxyList
+
+	for _, entry := range strings.Split(noProxy, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+
+		if entry == "*" {
+			list.all = true
+			continue
+		}
+
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			list.networks = append(list.networks, network)
+			continue
+		}
+
+		list.hosts = append(list.hosts, entry)
+	}
+
+	return list
+}
+
+func (l noProxyList) match(host string) bool {
+	if l.all {
+		return true
+	}
+
+	host = strings.ToLower(host)
+
+	if ip := net.ParseIP(host); ip != nil {
+		for _, network := range l.networks {
+			if network.Contains(ip) {
+				return true
+			}
+		}
+	}
+
+	for _, entry := range l.hosts {
+		domain := strings.TrimPrefix(entry, ".")
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,305 @@
+package client
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+const (
+	// defaultSessionTTL is used when VCD doesn't report token expiration (login with password)
+	defaultSessionTTL = 20 * time.Minute
+	// sessionExpirationMargin - session is refreshed a bit earlier than it expires
+	sessionExpirationMargin = time.Minute
+	// sessionLockTimeout - lock of another process is considered stale after this time
+	sessionLockTimeout = 2 * time.Minute
+	sessionLockRetry   = 200 * time.Millisecond
+)
+
+// cachedSession is a bearer token of VCD session shared between plugin processes
+type cachedSession struct {
+	Href       string    `json:"href"`
+	Org        string    `json:"org"`
+	User       string    `json:"user"`
+	AuthHeader string    `json:"auth_header"`
+	Token      string    `json:"token"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// sessionCache keeps VCD sessions in files keyed by href/org/user
+type sessionCache struct {
+	path string
+}
+
+func newSessionCache(cfg ConfigClient) *sessionCache {
+	if cfg.SessionCacheDir == "" {
+		return nil
+	}
+
+	key := sha256.Sum256([]byte(strings.Join([]string{cfg.Url.String(), cfg.Org, sessionUser(cfg)}, "\n")))
+
+	return &sessionCache{
+		path: filepath.Join(cfg.SessionCacheDir, hex.EncodeToString(key[:])+".json"),
+	}
+}
+
+// sessionUser identifies the user of the session. Tokens are not stored in the key
+func sessionUser(cfg ConfigClient) string {
+	switch {
+	case cfg.APIToken != "":
+		sum := sha256.Sum256([]byte(cfg.APIToken))
+		return "api-token:" + hex.EncodeToString(sum[:8])
+	case cfg.TokenFile != "":
+		return "token-file:" + cfg.TokenFile
+	}
+
+	return cfg.UserName
+}
+
+func (s *cachedSession) valid() bool {
+	return s != nil && s.Token != "" && time.Now().Add(sessionExpirationMargin).Before(s.ExpiresAt)
+}
+
+func (c *sessionCache) load() *cachedSession {
+	content, err := os.ReadFile(c.path)
+	if err != nil {
+		return nil
+	}
+
+	var session cachedSession
+	if err := json.Unmarshal(content, &session); err != nil {
+		log.Debugf("sessionCache.load.Unmarshal error: %v", err)
+		return nil
+	}
+
+	return &session
+}
+
+func (c *sessionCache) save(session cachedSession) error {
+	if err := os.MkdirAll(filepath.Dir(c.path), 0700); err != nil {
+		return fmt.Errorf("sessionCache.save.MkdirAll error: %w", err)
+	}
+
+	content, err := json.Marshal(session)
+	if err != nil {
+		return fmt.Errorf("sessionCache.save.Marshal error: %w", err)
+	}
+
+	tmpPath := fmt.Sprintf("%s.%d.tmp", c.path, os.Getpid())
+	if err := os.WriteFile(tmpPath, content, 0600); err != nil {
+		return fmt.Errorf("sessionCache.save.WriteFile error: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, c.path); err != nil {
+		return fmt.Errorf("sessionCache.save.Rename error: %w", err)
+	}
+
+	return nil
+}
+
+func (c *sessionCache) remove() {
+	if err := os.Remove(c.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Debugf("sessionCache.remove error: %v", err)
+	}
+}
+
+// lock takes an exclusive lock file, so only one plugin process refreshes the session
+func (c *sessionCache) lock() (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(c.path), 0700); err != nil {
+		return nil, fmt.Errorf("sessionCache.lock.MkdirAll error: %w", err)
+	}
+
+	lockPath := c.path + ".lock"
+	deadline := time.Now().Add(sessionLockTimeout)
+
+	for {
+		file, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			_ = file.Close()
+
+			return func() {
+				if err := os.Remove(lockPath); err != nil {
+					log.Debugf("sessionCache.unlock error: %v", err)
+				}
+			}, nil
+		}
+
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("sessionCache.lock.OpenFile error: %w", err)
+		}
+
+		// lock of a crashed process
+		if info, errStat := os.Stat(lockPath); errStat == nil && time.Since(info.ModTime()) > sessionLockTimeout {
+			log.Infof("sessionCache.lock removes stale lock %s", lockPath)
+			_ = os.Remove(lockPath)
+			continue
+		}
+
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("sessionCache.lock timeout waiting for %s", lockPath)
+		}
+
+		time.Sleep(sessionLockRetry)
+	}
+}
+
+// login restores cached session or authenticates and caches the new session.
+// staleToken is a token which was rejected by VCD and must not be reused
+func (c *VCloudClient) login(staleToken string) error {
+	c.loggingIn = true
+	defer func() {
+		c.loggingIn = false
+	}()
+
+	if c.sessions == nil {
+		_, err := c.authenticate()
+		return err
+	}
+
+	// fast path without lock: another process already has a valid session
+	if session := c.sessions.load(); session.valid() && session.Token != staleToken {
+		if err := c.restoreSession(session); err == nil {
+			return nil
+		}
+
+		staleToken = session.Token
+	}
+
+	unlock, err := c.sessions.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// session could be refreshed while waiting for the lock
+	if session := c.sessions.load(); session.valid() && session.Token != staleToken {
+		if err := c.restoreSession(session); err == nil {
+			return nil
+		}
+	}
+
+	c.sessions.remove()
+
+	expiresAt, err := c.authenticate()
+	if err != nil {
+		return err
+	}
+
+	errSave := c.sessions.save(cachedSession{
+		Href:       c.cfg.Url.String(),
+		Org:        c.cfg.Org,
+		User:       sessionUser(c.cfg),
+		AuthHeader: c.Client.Client.VCDAuthHeader,
+		Token:      c.Client.Client.VCDToken,
+		ExpiresAt:  expiresAt,
+	})
+	if errSave != nil {
+		log.Warnf("VCloudClient.login unable to cache session: %v", errSave)
+	}
+
+	return nil
+}
+
+// restoreSession sets cached token to the client. SetToken checks that the token still works
+func (c *VCloudClient) restoreSession(session *cachedSession) error {
+	log.Debugf("VCloudClient.restoreSession reuse session of %s expiring at %s", session.User, session.ExpiresAt)
+
+	if err := c.Client.SetToken(c.cfg.Org, session.AuthHeader, session.Token); err != nil {
+		log.Infof("VCloudClient.restoreSession cached session was rejected, re-authenticating: %v", err)
+
+		c.Client.Client.VCDToken = ""
+		c.Client.Client.VCDAuthHeader = ""
+		c.Client.Client.UsingBearerToken = false
+
+		return err
+	}
+
+	return nil
+}
+
+// reauthTransport re-authenticates and retries requests rejected with 401 when session expired
+type reauthTransport struct {
+	base   http.RoundTripper
+	client *VCloudClient
+	mu     sync.Mutex
+}
+
+func (t *reauthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	// login requests are not retried, login handles rejected sessions itself
+	if t.client.loggingIn {
+		return resp, err
+	}
+
+	authHeader := t.client.Client.Client.VCDAuthHeader
+	usedToken := req.Header.Get(authHeader)
+	if authHeader == "" || usedToken == "" {
+		return resp, err
+	}
+
+	// request body can't be sent twice
+	if req.Body != nil && req.GetBody == nil {
+		return resp, err
+	}
+
+	newToken, errAuth := t.refresh(usedToken)
+	if errAuth != nil {
+		log.Errorf("reauthTransport.refresh error: %v", errAuth)
+		return resp, err
+	}
+
+	_ = resp.Body.Close()
+
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, errBody := req.GetBody()
+		if errBody != nil {
+			return nil, errBody
+		}
+		retry.Body = body
+	}
+
+	retry.Header.Set(t.client.Client.Client.VCDAuthHeader, newToken)
+	if retry.Header.Get("Authorization") != "" {
+		retry.Header.Set("Authorization", "bearer "+newToken)
+	}
+
+	return t.base.RoundTrip(retry)
+}
+
+// refresh logs in again if nobody did it after usedToken was rejected
+func (t *reauthTransport) refresh(usedToken string) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	client := &t.client.Client.Client
+	if client.VCDToken != usedToken {
+		return client.VCDToken, nil
+	}
+
+	log.Infof("reauthTransport session expired, re-authenticating")
+
+	// login requests must go without expired token
+	client.VCDToken = ""
+	client.UsingBearerToken = false
+
+	if err := t.client.login(usedToken); err != nil {
+		return "", err
+	}
+
+	return client.VCDToken, nil
+}
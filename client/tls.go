@@ -0,0 +1,183 @@
+package client
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/docker/machine/libmachine/log"
+	"github.com/vmware/go-vcloud-director/v2/govcd"
+)
+
+// certVerifier verifies VCD certificate with custom CA bundle and/or SHA-256 fingerprint.
+// Errors name the certificate which did not match
+type certVerifier struct {
+	serverName  string
+	roots       *x509.CertPool
+	fingerprint []byte
+}
+
+// ParseTLSFingerprint parses SHA-256 fingerprint in hex with or without colons
+func ParseTLSFingerprint(fingerprint string) ([]byte, error) {
+	normalized := strings.ReplaceAll(strings.TrimSpace(fingerprint), ":", "")
+
+	decoded, err := hex.DecodeString(normalized)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SHA-256 fingerprint %q: %w", fingerprint, err)
+	}
+
+	if len(decoded) != sha256.Size {
+		return nil, fmt.Errorf("invalid SHA-256 fingerprint %q: expected %d bytes, got %d", fingerprint, sha256.Size, len(decoded))
+	}
+
+	return decoded, nil
+}
+
+// configureTLS applies vcd-ca-cert and vcd-tls-fingerprint to the HTTP transport of govcd client
+func configureTLS(vcdClient *govcd.VCDClient, cfg ConfigClient) error {
+	if cfg.CACert == "" && cfg.TLSFingerprint == "" {
+		return nil
+	}
+
+	transport, ok := vcdClient.Client.Http.Transport.(*http.Transport)
+	if !ok {
+		return fmt.Errorf("configureTLS unexpected transport type: %T", vcdClient.Client.Http.Transport)
+	}
+
+	verifier := certVerifier{
+		serverName: cfg.Url.Hostname(),
+	}
+
+	if cfg.CACert != "" {
+		log.Infof("configureTLS using CA bundle %s", cfg.CACert)
+
+		pem, err := os.ReadFile(cfg.CACert)
+		if err != nil {
+			return fmt.Errorf("configureTLS.ReadFile CA bundle error: %w", err)
+		}
+
+		roots, err := x509.SystemCertPool()
+		if err != nil || roots == nil {
+			roots = x509.NewCertPool()
+		}
+
+		if !roots.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("configureTLS no PEM certificates found in %s", cfg.CACert)
+		}
+
+		verifier.roots = roots
+	}
+
+	if cfg.TLSFingerprint != "" {
+		log.Infof("configureTLS pinning certificate with SHA-256 fingerprint %s", cfg.TLSFingerprint)
+
+		fingerprint, err := ParseTLSFingerprint(cfg.TLSFingerprint)
+		if err != nil {
+			return err
+		}
+
+		verifier.fingerprint = fingerprint
+	}
+
+	// chain is verified by certVerifier instead of crypto/tls to name the failed certificate
+	transport.TLSClientConfig = &tls.Config{
+		InsecureSkipVerify: true,
+		VerifyConnection:   verifier.verify,
+	}
+
+	return nil
+}
+
+func (v certVerifier) verify(cs tls.ConnectionState) error {
+	if len(cs.PeerCertificates) == 0 {
+		return fmt.Errorf("vcd server %s presented no certificates", v.serverName)
+	}
+
+	leaf := cs.PeerCertificates[0]
+
+	if v.roots != nil {
+		intermediates := x509.NewCertPool()
+		for _, cert := range cs.PeerCertificates[1:] {
+			intermediates.AddCert(cert)
+		}
+
+		_, err := leaf.Verify(x509.VerifyOptions{
+			DNSName:       v.serverName,
+			Roots:         v.roots,
+			Intermediates: intermediates,
+		})
+		if err != nil {
+			return fmt.Errorf("certificate %s of %s is not trusted by vcd-ca-cert: %w", describeCert(leaf), v.serverName, err)
+		}
+	}
+
+	if v.fingerprint != nil {
+		return v.verifyFingerprint(cs.PeerCertificates)
+	}
+
+	return nil
+}
+
+// verifyFingerprint checks the pin against the leaf certificate. A pinned intermediate or CA certificate
+// must be a trust anchor of the leaf for the server name, appending it to another chain isn't enough
+func (v certVerifier) verifyFingerprint(chain []*x509.Certificate) error {
+	leaf := chain[0]
+
+	if sum := sha256.Sum256(leaf.Raw); bytes.Equal(sum[:], v.fingerprint) {
+		return nil
+	}
+
+	presented := []string{describeCert(leaf)}
+
+	for i, cert := range chain[1:] {
+		sum := sha256.Sum256(cert.Raw)
+		if !bytes.Equal(sum[:], v.fingerprint) {
+			presented = append(presented, describeCert(cert))
+			continue
+		}
+
+		roots := x509.NewCertPool()
+		roots.AddCert(cert)
+
+		intermediates := x509.NewCertPool()
+		for _, intermediate := range chain[1 : i+1] {
+			intermediates.AddCert(intermediate)
+		}
+
+		_, err := leaf.Verify(x509.VerifyOptions{
+			DNSName:       v.serverName,
+			Roots:         roots,
+			Intermediates: intermediates,
+		})
+		if err != nil {
+			return fmt.Errorf("certificate %s of %s is not issued by pinned certificate %s: %w",
+				describeCert(leaf), v.serverName, describeCert(cert), err)
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("no certificate of %s matches vcd-tls-fingerprint %s, presented: %s",
+		v.serverName, formatFingerprint(v.fingerprint), strings.Join(presented, ", "))
+}
+
+func describeCert(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+
+	return fmt.Sprintf("%q (SHA-256 %s)", cert.Subject.String(), formatFingerprint(sum[:]))
+}
+
+func formatFingerprint(fingerprint []byte) string {
+	parts := make([]string, 0, len(fingerprint))
+	for _, b := range fingerprint {
+		parts = append(parts, fmt.Sprintf("%02X", b))
+	}
+
+	return strings.Join(parts, ":")
+}
@@ -0,0 +1,136 @@
+package client
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// testCert is a certificate with its key for signing other test certificates
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// newTestCert creates a CA certificate (isCA) or a server certificate for dnsName, signed by parent or self-signed
+func newTestCert(t *testing.T, commonName, dnsName string, isCA bool, parent *testCert) testCert {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey error: %v", err)
+	}
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatalf("rand.Int error: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	if dnsName != "" {
+		template.DNSNames = []string{dnsName}
+	}
+
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatalf("CreateCertificate error: %v", err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("ParseCertificate error: %v", err)
+	}
+
+	return testCert{cert: cert, key: key}
+}
+
+func fingerprintOf(cert *x509.Certificate) []byte {
+	sum := sha256.Sum256(cert.Raw)
+
+	return sum[:]
+}
+
+func TestCertVerifierFingerprint(t *testing.T) {
+	const serverName = "vcd.example.com"
+
+	ca := newTestCert(t, "test CA", "", true, nil)
+	intermediate := newTestCert(t, "test intermediate", "", true, &ca)
+	leaf := newTestCert(t, serverName, serverName, false, &intermediate)
+	forged := newTestCert(t, serverName, serverName, false, nil)
+	otherHost := newTestCert(t, "other.example.com", "other.example.com", false, &intermediate)
+
+	tests := []struct {
+		name  string
+		pin   *x509.Certificate
+		chain []*x509.Certificate
+		ok    bool
+	}{
+		{name: "leaf pin", pin: leaf.cert, chain: []*x509.Certificate{leaf.cert, intermediate.cert}, ok: true},
+		{name: "self-signed leaf pin", pin: forged.cert, chain: []*x509.Certificate{forged.cert}, ok: true},
+		{name: "intermediate pin", pin: intermediate.cert, chain: []*x509.Certificate{leaf.cert, intermediate.cert}, ok: true},
+		{name: "CA pin", pin: ca.cert, chain: []*x509.Certificate{leaf.cert, intermediate.cert, ca.cert}, ok: true},
+		{name: "forged leaf with appended pinned intermediate", pin: intermediate.cert, chain: []*x509.Certificate{forged.cert, intermediate.cert}},
+		{name: "forged leaf with appended pinned CA", pin: ca.cert, chain: []*x509.Certificate{forged.cert, intermediate.cert, ca.cert}},
+		{name: "pinned intermediate for other host", pin: intermediate.cert, chain: []*x509.Certificate{otherHost.cert, intermediate.cert}},
+		{name: "no matching certificate", pin: ca.cert, chain: []*x509.Certificate{leaf.cert, intermediate.cert}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			verifier := certVerifier{serverName: serverName, fingerprint: fingerprintOf(test.pin)}
+
+			err := verifier.verify(tls.ConnectionState{PeerCertificates: test.chain})
+			if test.ok && err != nil {
+				t.Fatalf("verify error: %v", err)
+			}
+
+			if !test.ok && err == nil {
+				t.Fatal("verify error expected")
+			}
+		})
+	}
+}
+
+func TestParseTLSFingerprint(t *testing.T) {
+	valid := "AB:CD:EF:01:23:45:67:89:AB:CD:EF:01:23:45:67:89:AB:CD:EF:01:23:45:67:89:AB:CD:EF:01:23:45:67:89"
+
+	tests := []struct {
+		fingerprint string
+		ok          bool
+	}{
+		{fingerprint: valid, ok: true},
+		{fingerprint: " abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789 ", ok: true},
+		{fingerprint: valid[:len(valid)-3]},
+		{fingerprint: "ZZ" + valid[2:]},
+		{fingerprint: ""},
+	}
+
+	for _, test := range tests {
+		_, err := ParseTLSFingerprint(test.fingerprint)
+		if (err == nil) != test.ok {
+			t.Errorf("ParseTLSFingerprint(%q) error = %v, want ok %v", test.fingerprint, err, test.ok)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package client
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/docker/machine/libmachine/log"
+	"github.com/vmware/go-vcloud-director/v2/govcd"
+)
+
+const (
+	// TemplateChecksumMetadataKey is a metadata key of vApp template with SHA-256 of the uploaded file
+	TemplateChecksumMetadataKey = "docker-machine-source-sha256"
+
+	templateUploadPieceSize        = 1024 * 1024
+	templateUploadProgressInterval = 10 * time.Second
+)
+
+// ensureCatalogItem returns catalog item of the config. If the item is missing and template source is set,
+// the source is uploaded to the catalog. Existing item must be uploaded from the same file
+func (c *VCloudClient) ensureCatalogItem(catalog *govcd.Catalog) (*govcd.CatalogItem, error) {
+	catalogItem, err := c.findCatalogItem(catalog)
+	if c.cfg.TemplateSource == "" {
+		return catalogItem, err
+	}
+
+	if err != nil && !errors.Is(err, govcd.ErrorEntityNotFound) {
+		return nil, err
+	}
+
+	checksum, err := fileChecksum(c.cfg.TemplateSource)
+	if err != nil {
+		return nil, err
+	}
+
+	if catalogItem != nil {
+		if err := verifyTemplateChecksum(catalogItem, c.cfg.TemplateSource, checksum); err != nil {
+			return nil, err
+		}
+
+		return catalogItem, nil
+	}
+
+	if err := uploadTemplate(catalog, c.cfg.TemplateSource, c.cfg.CatalogItem, checksum); err != nil {
+		return nil, err
+	}
+
+	return catalog.GetCatalogItemByName(c.cfg.CatalogItem, true)
+}
+
+// uploadTemplate uploads OVA or OVF file as a catalog item and stores checksum of the file in its metadata.
+// Catalog item of failed upload is deleted
+func uploadTemplate(catalog *govcd.Catalog, source, itemName, checksum string) (err error) {
+	log.Infof("uploadTemplate uploads %s to catalog %s as %s", source, catalog.Catalog.Name, itemName)
+
+	defer func() {
+		if err == nil {
+			return
+		}
+
+		if item, errItem := catalog.GetCatalogItemByName(itemName, true); errItem == nil {
+			if errDelete := item.Delete(); errDelete != nil {
+				log.Errorf("uploadTemplate.Delete of failed catalog item %s error: %v", itemName, errDelete)
+			}
+		}
+	}()
+
+	uploadTask, err := catalog.UploadOvf(source, itemName, "Uploaded by docker-machine from "+filepath.Base(source), templateUploadPieceSize)
+	if err != nil {
+		return fmt.Errorf("uploadTemplate.UploadOvf error: %w", err)
+	}
+
+	if err := waitTemplateUpload(&uploadTask, itemName); err != nil {
+		return err
+	}
+
+	if err := uploadTask.WaitTaskCompletion(); err != nil {
+		return fmt.Errorf("uploadTemplate.WaitTaskCompletion error: %w", err)
+	}
+
+	catalogItem, err := catalog.GetCatalogItemByName(itemName, true)
+	if err != nil {
+		return fmt.Errorf("uploadTemplate.GetCatalogItemByName error: %w", err)
+	}
+
+	vAppTemplate, err := catalogItem.GetVAppTemplate()
+	if err != nil {
+		return fmt.Errorf("uploadTemplate.GetVAppTemplate error: %w", err)
+	}
+
+	if _, err := vAppTemplate.AddMetadata(TemplateChecksumMetadataKey, checksum); err != nil {
+		return fmt.Errorf("uploadTemplate.AddMetadata error: %w", err)
+	}
+
+	log.Infof("uploadTemplate uploaded %s with sha256 %s", itemName, checksum)
+
+	return nil
+}
+
+// waitTemplateUpload logs upload progress until all files are transferred
+func waitTemplateUpload(uploadTask *govcd.UploadTask, itemName string) error {
+	lastProgress := ""
+
+	for {
+		if err := uploadTask.GetUploadError(); err != nil {
+			return fmt.Errorf("waitTemplateUpload of %s error: %w", itemName, err)
+		}
+
+		progress := uploadTask.GetUploadProgress()
+		if progress != lastProgress {
+			log.Infof("waitTemplateUpload %s upload progress %s%%", itemName, progress)
+			lastProgress = progress
+		}
+
+		if progress == "100.00" {
+			return nil
+		}
+
+		// upload may be cancelled in VCD UI
+		if err := uploadTask.Refresh(); err != nil {
+			return fmt.Errorf("waitTemplateUpload.Refresh error: %w", err)
+		}
+
+		switch uploadTask.Task.Task.Status {
+		case "queued", "preRunning", "running":
+		default:
+			return nil
+		}
+
+		time.Sleep(templateUploadProgressInterval)
+	}
+}
+
+// verifyTemplateChecksum checks that existing catalog item was uploaded from the file with the same checksum
+func verifyTemplateChecksum(catalogItem *govcd.CatalogItem, source, checksum string) error {
+	vAppTemplate, err := catalogItem.GetVAppTemplate()
+	if err != nil {
+		return fmt.Errorf("verifyTemplateChecksum.GetVAppTemplate error: %w", err)
+	}
+
+	metadata, err := vAppTemplate.GetMetadata()
+	if err != nil {
+		return fmt.Errorf("verifyTemplateChecksum.GetMetadata error: %w", err)
+	}
+
+	for _, entry := range metadata.MetadataEntry {
+		if entry.Key != TemplateChecksumMetadataKey || entry.TypedValue == nil {
+			continue
+		}
+
+		if entry.TypedValue.Value != checksum {
+			return fmt.Errorf("catalog item %s was uploaded from another file (sha256 %s), %s has sha256 %s: delete the item or use another vcd-catalogitem",
+				catalogItem.CatalogItem.Name, entry.TypedValue.Value, source, checksum)
+		}
+
+		return nil
+	}
+
+	log.Warnf("verifyTemplateChecksum catalog item %s has no %s metadata, it can't be compared with %s", catalogItem.CatalogItem.Name, TemplateChecksumMetadataKey, source)
+
+	return nil
+}
+
+func fileChecksum(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("fileChecksum.Open error: %w", err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("fileChecksum of %s error: %w", path, err)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/DimKush/docker-driver-vcd/processor"
+)
+
+// persistentDisks lists persistent disks created with vcd-persistent-disk in VDC of the machine.
+// Detached disks are kept for the next create, a disk is orphaned only when no machine in the store
+// references it. -delete-orphaned lists orphaned disks and deletes them only with -yes
+func persistentDisks(args []string) error {
+	fs := flag.NewFlagSet("persistent-disks", flag.ExitOnError)
+	storePath := fs.String("storage-path", defaultStorePath(), "docker-machine storage path")
+	deleteOrphaned := fs.Bool("delete-orphaned", false, "delete detached persistent disks which no machine in the store references (dry run without -yes)")
+	confirmed := fs.Bool("yes", false, "confirm deletion of orphaned disks")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: vcd-tool persistent-disks [-delete-orphaned [-yes]] MACHINE\n\nMachine config is used to connect to its VDC.")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("machine name is required")
+	}
+
+	host, err := loadMachine(*storePath, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	vcdClient, err := host.Driver.NewVCloudClient()
+	if err != nil {
+		return err
+	}
+
+	disks, err := processor.ListPersistentDisks(vcdClient.VirtualDataCenter)
+	if err != nil {
+		return err
+	}
+
+	referenced, err := referencedPersistentDisks(*storePath)
+	if err != nil {
+		return err
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "NAME\tSIZE MB\tATTACHED TO\tMACHINES\tDESCRIPTION")
+
+	orphaned := make([]processor.PersistentDiskInfo, 0)
+	for _, disk := range disks {
+		name := disk.Disk.Disk.Name
+
+		attachedTo := disk.AttachedTo
+		if attachedTo == "" {
+			attachedTo = "-"
+		}
+
+		machines := strings.Join(referenced[name], ",")
+		if machines == "" {
+			machines = "-"
+		}
+
+		if disk.AttachedTo == "" && len(referenced[name]) == 0 {
+			orphaned = append(orphaned, disk)
+		}
+
+		fmt.Fprintf(writer, "%s\t%d\t%s\t%s\t%s\n", name, disk.Disk.Disk.SizeMb, attachedTo, machines, disk.Disk.Disk.Description)
+	}
+
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	if !*deleteOrphaned {
+		return nil
+	}
+
+	if len(orphaned) == 0 {
+		fmt.Println("no orphaned persistent disks")
+		return nil
+	}
+
+	if !*confirmed {
+		for _, disk := range orphaned {
+			fmt.Printf("%s: would be deleted\n", disk.Disk.Disk.Name)
+		}
+
+		fmt.Println("dry run, repeat with -yes to delete")
+
+		return nil
+	}
+
+	for _, disk := range orphaned {
+		if err := processor.DeletePersistentDisk(disk); err != nil {
+			return fmt.Errorf("%s: %w", disk.Disk.Disk.Name, err)
+		}
+
+		fmt.Printf("%s: deleted\n", disk.Disk.Disk.Name)
+	}
+
+	return nil
+}
+
+// referencedPersistentDisks returns names of machines in the store by vcd-persistent-disk name
+func referencedPersistentDisks(storePath string) (map[string][]string, error) {
+	names, unreadable, err := listMachines(storePath)
+	if err != nil {
+		return nil, err
+	}
+
+	// a machine with broken config may reference any disk, no disk is orphaned then
+	if len(unreadable) > 0 {
+		messages := make([]string, 0, len(unreadable))
+		for _, errMachine := range unreadable {
+			messages = append(messages, errMachine.Error())
+		}
+
+		return nil, fmt.Errorf("unable to read configs of machines in %s, fix or remove them first: %s",
+			storePath, strings.Join(messages, "; "))
+	}
+
+	referenced := make(map[string][]string)
+
+	for _, name := range names {
+		host, err := loadMachine(storePath, name)
+		if err != nil {
+			return nil, err
+		}
+
+		if host.Driver.PersistentDisk == "" {
+			continue
+		}
+
+		disk, err := processor.ParsePersistentDiskSpec(host.Driver.PersistentDisk)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+
+		referenced[disk.Name] = append(referenced[disk.Name], name)
+	}
+
+	return referenced, nil
+}
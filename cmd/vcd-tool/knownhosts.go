@@ -0,0 +1,52 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// knownHosts prints known_hosts entry of the machine with its pinned host key and optionally checks
+// that the guest still presents that key
+func knownHosts(args []string) error {
+	fs := flag.NewFlagSet("known-hosts", flag.ExitOnError)
+	storePath := fs.String("storage-path", defaultStorePath(), "docker-machine storage path")
+	verify := fs.Bool("verify", false, "connect to SSH port of the machine and check its host key")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: vcd-tool known-hosts [-verify] MACHINE\n\nPrints known_hosts entry of the host key pinned on create, ex.: vcd-tool known-hosts m1 >> ~/.ssh/known_hosts")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("machine name is required")
+	}
+
+	name := fs.Arg(0)
+
+	host, err := loadMachine(*storePath, name)
+	if err != nil {
+		return err
+	}
+
+	entry, err := host.Driver.KnownHostsEntry()
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	if *verify {
+		if err := host.Driver.VerifyHostKey(); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+
+		fmt.Fprintf(os.Stderr, "%s: host key %s verified\n", name, host.Driver.HostKeyFingerprint)
+	}
+
+	fmt.Println(entry)
+
+	return nil
+}
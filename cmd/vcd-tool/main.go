@@ -0,0 +1,154 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/DimKush/docker-driver-vcd/credentials"
+)
+
+// vcd-tool is a companion CLI for machines created with docker-machine-driver-vcd.
+// It works with machines config.json in docker-machine store
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	var err error
+
+	switch os.Args[1] {
+	case "known-hosts":
+		err = knownHosts(os.Args[2:])
+	case "migrate-credentials":
+		err = migrateCredentials(os.Args[2:])
+	case "persistent-disks":
+		err = persistentDisks(os.Args[2:])
+	case "resize":
+		err = resize(os.Args[2:])
+	case "help", "-h", "--help":
+		usage()
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, `Usage: vcd-tool COMMAND [OPTIONS]
+
+Commands:
+  known-hosts          print known_hosts entry of the pinned host key of a machine and verify it
+  migrate-credentials  move inline vcd passwords from machine config to a credential source
+  persistent-disks     list persistent disks in VDC of a machine and delete orphaned ones
+  resize               change CPU, memory and disk size of a machine`)
+}
+
+func migrateCredentials(args []string) error {
+	fs := flag.NewFlagSet("migrate-credentials", flag.ExitOnError)
+	storePath := fs.String("storage-path", defaultStorePath(), "docker-machine storage path")
+	passwordSource := fs.String("password-source", "", "credential reference: env:NAME, file:/path, helper:NAME or keyring:SERVICE")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: vcd-tool migrate-credentials -password-source REF [MACHINE...]\n\nMigrates all vcd machines if no machine is given.")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *passwordSource == "" {
+		fs.Usage()
+		return fmt.Errorf("-password-source is required")
+	}
+
+	names := fs.Args()
+	if len(names) == 0 {
+		var (
+			unreadable []error
+			err        error
+		)
+
+		names, unreadable, err = listMachines(*storePath)
+		if err != nil {
+			return err
+		}
+
+		for _, errMachine := range unreadable {
+			fmt.Fprintf(os.Stderr, "skipped %v\n", errMachine)
+		}
+	}
+
+	hosts := make([]*machineHost, 0, len(names))
+
+	for _, name := range names {
+		host, err := loadMachine(*storePath, name)
+		if err != nil {
+			return err
+		}
+
+		if host.Driver.UserPassword == "" {
+			fmt.Printf("%s: no inline password, skipped\n", name)
+			continue
+		}
+
+		hosts = append(hosts, host)
+	}
+
+	if err := checkSharedSource(*passwordSource, hosts); err != nil {
+		return err
+	}
+
+	for _, host := range hosts {
+		name := host.Driver.MachineName
+
+		if err := host.Driver.MigrateCredentials(*passwordSource); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+
+		if err := host.save(); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+
+		fmt.Printf("%s: password moved to %s\n", name, *passwordSource)
+	}
+
+	return nil
+}
+
+// checkSharedSource refuses env: and file: sources for machines with different accounts or passwords.
+// Such source keeps a single secret, every stored password would overwrite the previous one
+func checkSharedSource(passwordSource string, hosts []*machineHost) error {
+	kind := strings.SplitN(passwordSource, ":", 2)[0]
+	if kind != credentials.KindEnv && kind != credentials.KindFile {
+		return nil
+	}
+
+	if len(hosts) < 2 {
+		return nil
+	}
+
+	first := hosts[0].Driver
+
+	for _, host := range hosts[1:] {
+		driver := host.Driver
+
+		if driver.Href != first.Href || driver.UserName != first.UserName || driver.Org != first.Org ||
+			driver.UserPassword != first.UserPassword {
+			return fmt.Errorf("%s keeps a single password, machines %s and %s have different vcd accounts or passwords: "+
+				"migrate them one by one with separate sources or use helper: or keyring: source",
+				passwordSource, first.MachineName, driver.MachineName)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/DimKush/docker-driver-vcd/vmwarevcloud"
+	"github.com/docker/machine/libmachine/state"
+)
+
+// resize changes CPU, memory and disk size of existing machine and stores the new size in its config.
+// Root filesystem of running machine is grown over SSH when the disk grows
+func resize(args []string) error {
+	fs := flag.NewFlagSet("resize", flag.ExitOnError)
+	storePath := fs.String("storage-path", defaultStorePath(), "docker-machine storage path")
+	cpuCount := fs.Int("cpu-count", 0, "new CPU count")
+	coresPerSocket := fs.Int("cores-per-socket", 0, "new cores per socket")
+	memorySize := fs.Int("memory-size", 0, "new memory size in MB")
+	diskSize := fs.Int("disk-size", 0, "new OS disk size in MB, disk can only grow")
+	noGrow := fs.Bool("no-grow-filesystem", false, "don't grow root partition and filesystem over SSH")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: vcd-tool resize [-cpu-count N] [-cores-per-socket N] [-memory-size MB] [-disk-size MB] MACHINE\n\nVM is powered off only if the change can't be hot added.")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("machine name is required")
+	}
+
+	spec := vmwarevcloud.ResizeSpec{
+		CPUCount:       *cpuCount,
+		CoresPerSocket: *coresPerSocket,
+		MemorySize:     *memorySize,
+		DiskSize:       *diskSize,
+	}
+
+	if spec == (vmwarevcloud.ResizeSpec{}) {
+		fs.Usage()
+		return fmt.Errorf("nothing to resize")
+	}
+
+	name := fs.Arg(0)
+
+	host, err := loadMachine(*storePath, name)
+	if err != nil {
+		return err
+	}
+
+	previousDiskSize := host.Driver.DiskSize
+
+	if err := host.Driver.Resize(spec); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	if err := host.save(); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	fmt.Printf("%s: resized to %d CPU, %d MB memory, %d MB disk\n", name, host.Driver.CPUCount, host.Driver.MemorySize, host.Driver.DiskSize)
+
+	if *noGrow || host.Driver.DiskSize == previousDiskSize {
+		return nil
+	}
+
+	machineState, err := host.Driver.GetState()
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	if machineState != state.Running {
+		fmt.Printf("%s: machine is %s, root filesystem is not grown\n", name, machineState)
+		return nil
+	}
+
+	output, err := host.Driver.GrowRootFilesystem()
+	if output != "" {
+		fmt.Print(output)
+	}
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	fmt.Printf("%s: root filesystem grown\n", name)
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/DimKush/docker-driver-vcd/vmwarevcloud"
+)
+
+// machineHost is a docker-machine host config.json. Only Driver is decoded,
+// other fields are written back as is
+type machineHost struct {
+	path   string
+	fields map[string]json.RawMessage
+	Driver *vmwarevcloud.Driver
+}
+
+// defaultStorePath returns docker-machine store path like docker-machine does
+func defaultStorePath() string {
+	if storePath := os.Getenv("MACHINE_STORAGE_PATH"); storePath != "" {
+		return storePath
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ".docker/machine"
+	}
+
+	return filepath.Join(home, ".docker", "machine")
+}
+
+// listMachines returns names of all vcd machines in the store and errors of machine directories
+// whose config can't be read, such machine may be a vcd machine too
+func listMachines(storePath string) ([]string, []error, error) {
+	entries, err := os.ReadDir(filepath.Join(storePath, "machines"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("listMachines.ReadDir error: %w", err)
+	}
+
+	names := make([]string, 0, len(entries))
+	unreadable := make([]error, 0)
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		host, err := loadMachine(storePath, entry.Name())
+		if err != nil {
+			unreadable = append(unreadable, fmt.Errorf("%s: %w", entry.Name(), err))
+			continue
+		}
+
+		if host.driverName() == "vcd" {
+			names = append(names, entry.Name())
+		}
+	}
+
+	return names, unreadable, nil
+}
+
+// loadMachine reads config.json of the machine and decodes the driver
+func loadMachine(storePath, name string) (*machineHost, error) {
+	path := filepath.Join(storePath, "machines", name, "config.json")
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("loadMachine.ReadFile error: %w", err)
+	}
+
+	host := &machineHost{
+		path:   path,
+		fields: make(map[string]json.RawMessage),
+		Driver: vmwarevcloud.NewDriver(name, storePath).(*vmwarevcloud.Driver),
+	}
+
+	if err := json.Unmarshal(content, &host.fields); err != nil {
+		return nil, fmt.Errorf("loadMachine.Unmarshal %s error: %w", path, err)
+	}
+
+	if rawDriver, ok := host.fields["Driver"]; ok {
+		if err := json.Unmarshal(rawDriver, host.Driver); err != nil {
+			return nil, fmt.Errorf("loadMachine.Unmarshal driver of %s error: %w", name, err)
+		}
+	}
+
+	return host, nil
+}
+
+func (h *machineHost) driverName() string {
+	var driverName string
+	_ = json.Unmarshal(h.fields["DriverName"], &driverName)
+
+	return driverName
+}
+
+// save writes config.json back with the updated driver
+func (h *machineHost) save() error {
+	rawDriver, err := json.Marshal(h.Driver)
+	if err != nil {
+		return fmt.Errorf("machineHost.save.Marshal driver error: %w", err)
+	}
+
+	h.fields["Driver"] = rawDriver
+
+	content, err := json.MarshalIndent(h.fields, "", "    ")
+	if err != nil {
+		return fmt.Errorf("machineHost.save.MarshalIndent error: %w", err)
+	}
+
+	tmpPath := h.path + ".tmp"
+	if err := os.WriteFile(tmpPath, content, 0600); err != nil {
+		return fmt.Errorf("machineHost.save.WriteFile error: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, h.path); err != nil {
+		return fmt.Errorf("machineHost.save.Rename error: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,249 @@
+package credentials
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// Source represents a place where a secret is kept outside the machine config.
+// Reference format is <kind>:<value>
+//
+// env:NAME - secret is read from environment variable NAME
+//
+// file:/path/to/file - secret is read from the file
+//
+// helper:NAME - secret is read with docker credential helper docker-credential-NAME
+//
+// keyring:SERVICE - secret is read from OS keyring (secret-tool on Linux, security on macOS)
+type Source interface {
+	Resolve(lookup Lookup) (string, error)
+	Store(lookup Lookup, secret string) error
+}
+
+// Lookup identifies a secret in credential helpers and keyrings
+type Lookup struct {
+	ServerURL string
+	Account   string
+}
+
+const (
+	KindEnv     = "env"
+	KindFile    = "file"
+	KindHelper  = "helper"
+	KindKeyring = "keyring"
+)
+
+// helperPrefix is a prefix of docker credential helper binaries
+const helperPrefix = "docker-credential-"
+
+var ErrInvalidReference = errors.New("invalid credential reference")
+
+// Parse creates Source from the reference
+func Parse(ref string) (Source, error) {
+	parts := strings.SplitN(ref, ":", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return nil, fmt.Errorf("%w %q, expected <kind>:<value>", ErrInvalidReference, ref)
+	}
+
+	kind, value := parts[0], parts[1]
+
+	switch kind {
+	case KindEnv:
+		return envSource{name: value}, nil
+	case KindFile:
+		return fileSource{path: value}, nil
+	case KindHelper:
+		return helperSource{name: value}, nil
+	case KindKeyring:
+		return keyringSource{service: value}, nil
+	}
+
+	return nil, fmt.Errorf("%w %q, unknown kind %s (expected env, file, helper or keyring)", ErrInvalidReference, ref, kind)
+}
+
+// Resolve parses the reference and reads the secret
+func Resolve(ref string, lookup Lookup) (string, error) {
+	source, err := Parse(ref)
+	if err != nil {
+		return "", err
+	}
+
+	return source.Resolve(lookup)
+}
+
+type envSource struct {
+	name string
+}
+
+func (s envSource) Resolve(_ Lookup) (string, error) {
+	secret, ok := os.LookupEnv(s.name)
+	if !ok || secret == "" {
+		return "", fmt.Errorf("credentials.env variable %s is empty", s.name)
+	}
+
+	return secret, nil
+}
+
+func (s envSource) Store(_ Lookup, _ string) error {
+	return fmt.Errorf("credentials.env can't store secret, export %s instead", s.name)
+}
+
+type fileSource struct {
+	path string
+}
+
+func (s fileSource) Resolve(_ Lookup) (string, error) {
+	content, err := os.ReadFile(s.path)
+	if err != nil {
+		return "", fmt.Errorf("credentials.file.ReadFile error: %w", err)
+	}
+
+	secret := strings.TrimRight(string(content), "\r\n")
+	if secret == "" {
+		return "", fmt.Errorf("credentials.file %s is empty", s.path)
+	}
+
+	return secret, nil
+}
+
+func (s fileSource) Store(_ Lookup, secret string) error {
+	if err := os.WriteFile(s.path, []byte(secret+"\n"), 0600); err != nil {
+		return fmt.Errorf("credentials.file.WriteFile error: %w", err)
+	}
+
+	return nil
+}
+
+// helperSource works with docker credential helpers protocol:
+// https://github.com/docker/docker-credential-helpers
+type helperSource struct {
+	name string
+}
+
+type helperCredentials struct {
+	ServerURL string `json:"ServerURL"`
+	Username  string `json:"Username"`
+	Secret    string `json:"Secret"`
+}
+
+func (s helperSource) Resolve(lookup Lookup) (string, error) {
+	out, err := runCommand(strings.NewReader(lookup.ServerURL), helperPrefix+s.name, "get")
+	if err != nil {
+		return "", fmt.Errorf("credentials.helper %s get error: %w", s.name, err)
+	}
+
+	var creds helperCredentials
+	if err := json.Unmarshal(out, &creds); err != nil {
+		return "", fmt.Errorf("credentials.helper %s get invalid output: %w", s.name, err)
+	}
+
+	if creds.Secret == "" {
+		return "", fmt.Errorf("credentials.helper %s returned empty secret for %s", s.name, lookup.ServerURL)
+	}
+
+	return creds.Secret, nil
+}
+
+func (s helperSource) Store(lookup Lookup, secret string) error {
+	payload, err := json.Marshal(helperCredentials{
+		ServerURL: lookup.ServerURL,
+		Username:  lookup.Account,
+		Secret:    secret,
+	})
+	if err != nil {
+		return fmt.Errorf("credentials.helper.Marshal error: %w", err)
+	}
+
+	if _, err := runCommand(bytes.NewReader(payload), helperPrefix+s.name, "store"); err != nil {
+		return fmt.Errorf("credentials.helper %s store error: %w", s.name, err)
+	}
+
+	return nil
+}
+
+// keyringSource uses OS keyring tools, account is taken from Lookup
+type keyringSource struct {
+	service string
+}
+
+func (s keyringSource) Resolve(lookup Lookup) (string, error) {
+	var (
+		out []byte
+		err error
+	)
+
+	switch runtime.GOOS {
+	case "linux":
+		out, err = runCommand(nil, "secret-tool", "lookup", "service", s.service, "account", lookup.Account)
+	case "darwin":
+		out, err = runCommand(nil, "security", "find-generic-password", "-s", s.service, "-a", lookup.Account, "-w")
+	default:
+		return "", fmt.Errorf("credentials.keyring is not supported on %s", runtime.GOOS)
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("credentials.keyring lookup %s error: %w", s.service, err)
+	}
+
+	secret := strings.TrimRight(string(out), "\r\n")
+	if secret == "" {
+		return "", fmt.Errorf("credentials.keyring has no secret for service %s and account %s", s.service, lookup.Account)
+	}
+
+	return secret, nil
+}
+
+func (s keyringSource) Store(lookup Lookup, secret string) error {
+	var err error
+
+	switch runtime.GOOS {
+	case "linux":
+		_, err = runCommand(strings.NewReader(secret), "secret-tool", "store", "--label", s.service, "service", s.service, "account", lookup.Account)
+	case "darwin":
+		// security -i reads the command from stdin, so the secret doesn't appear in the process list
+		if strings.ContainsAny(secret, "\r\n") {
+			return fmt.Errorf("credentials.keyring secret must be a single line")
+		}
+
+		command := strings.Join([]string{"add-generic-password", "-U",
+			"-s", securityQuote(s.service), "-a", securityQuote(lookup.Account), "-w", securityQuote(secret)}, " ")
+		_, err = runCommand(strings.NewReader(command+"\n"), "security", "-i")
+	default:
+		return fmt.Errorf("credentials.keyring is not supported on %s", runtime.GOOS)
+	}
+
+	if err != nil {
+		return fmt.Errorf("credentials.keyring store %s error: %w", s.service, err)
+	}
+
+	return nil
+}
+
+// securityQuote quotes value as a single word of security -i command line
+func securityQuote(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
+
+func runCommand(stdin io.Reader, name string, args ...string) ([]byte, error) {
+	cmd := exec.Command(name, args...)
+	if stdin != nil {
+		cmd.Stdin = stdin
+	}
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return out, nil
+}
@@ -0,0 +1,208 @@
+package processor
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Linux distribution families of vcd-bootstrap-distro
+const (
+	BootstrapDistroAuto   = "auto"
+	BootstrapDistroDebian = "debian"
+	BootstrapDistroRHEL   = "rhel"
+	BootstrapDistroAlpine = "alpine"
+)
+
+// redactedValue replaces secrets in logged configs
+const redactedValue = "<redacted>"
+
+// sshUserPattern is a portable user name accepted by useradd and BusyBox adduser
+var sshUserPattern = regexp.MustCompile(`^[a-z_][a-z0-9_-]{0,31}$`)
+
+// BootstrapConfig is a guest setup of the SSH user
+type BootstrapConfig struct {
+	Distro              string
+	DisablePasswordAuth bool
+	DisableRootLogin    bool
+}
+
+// ValidateBootstrapDistro checks vcd-bootstrap-distro value
+func ValidateBootstrapDistro(distro string) error {
+	switch distro {
+	case BootstrapDistroAuto, BootstrapDistroDebian, BootstrapDistroRHEL, BootstrapDistroAlpine:
+		return nil
+	}
+
+	return fmt.Errorf("invalid vcd-bootstrap-distro %q, expected %s, %s, %s or %s", distro,
+		BootstrapDistroAuto, BootstrapDistroDebian, BootstrapDistroRHEL, BootstrapDistroAlpine)
+}
+
+// ValidateSSHUser checks that SSH user name is safe to create on any supported distribution
+func ValidateSSHUser(name string) error {
+	if !sshUserPattern.MatchString(name) {
+		return fmt.Errorf("invalid SSH user %q, expected lowercase letters, digits, _ and - up to 32 characters", name)
+	}
+
+	return nil
+}
+
+// shellQuote quotes value as a single POSIX shell word
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'"'"'`) + "'"
+}
+
+// buildHostKeyScript returns POSIX shell script which installs ed25519 host key generated by the driver,
+// so the first SSH connection can be checked against the pinned key
+func buildHostKeyScript(privateKey, publicKey string) string {
+	var script strings.Builder
+
+	script.WriteString("\n# SSH host key pinned by docker-machine\n")
+	script.WriteString("mkdir -p /etc/ssh\n")
+	script.WriteString("(umask 077; printf '%s\\n' " + shellQuote(strings.TrimSpace(privateKey)) + " > /etc/ssh/ssh_host_ed25519_key)\n")
+	script.WriteString("printf '%s\\n' " + shellQuote(strings.TrimSpace(publicKey)) + " > /etc/ssh/ssh_host_ed25519_key.pub\n")
+	script.WriteString("chmod 600 /etc/ssh/ssh_host_ed25519_key\n")
+	script.WriteString("chmod 644 /etc/ssh/ssh_host_ed25519_key.pub\n")
+	script.WriteString("if command -v restorecon >/dev/null 2>&1; then restorecon /etc/ssh/ssh_host_ed25519_key /etc/ssh/ssh_host_ed25519_key.pub; fi\n")
+	script.WriteString(bootstrapSSHDReload)
+
+	return script.String()
+}
+
+// authorizedKeys returns the machine key followed by additional keys, one key per line without blanks
+func authorizedKeys(machineKey string, additional []string) []string {
+	keys := make([]string, 0, len(additional)+1)
+
+	for _, key := range append([]string{machineKey}, additional...) {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+// buildBootstrapScript returns POSIX shell script which creates SSH user with the keys and passwordless sudo.
+// Sudo rule is written to /etc/sudoers.d and checked by visudo before it's installed
+func buildBootstrapScript(user string, keys []string, cfg BootstrapConfig) (string, error) {
+	if err := ValidateSSHUser(user); err != nil {
+		return "", err
+	}
+
+	if len(keys) == 0 {
+		return "", fmt.Errorf("no SSH key of user %s", user)
+	}
+
+	for _, key := range keys {
+		if strings.ContainsAny(key, "\r\n") {
+			return "", fmt.Errorf("SSH key of user %s must be a single line", user)
+		}
+	}
+
+	distro := cfg.Distro
+	if distro == "" {
+		distro = BootstrapDistroAuto
+	}
+
+	if err := ValidateBootstrapDistro(distro); err != nil {
+		return "", err
+	}
+
+	var script strings.Builder
+
+	script.WriteString("\n# SSH user of docker-machine\n")
+	script.WriteString("dm_user=" + shellQuote(user) + "\n")
+	script.WriteString("dm_keys=" + shellQuote(strings.Join(keys, "\n")) + "\n")
+	script.WriteString("dm_shell=/bin/sh\n")
+	script.WriteString("[ -x /bin/bash ] && dm_shell=/bin/bash\n")
+
+	switch distro {
+	case BootstrapDistroAuto:
+		script.WriteString(bootstrapDetectAlpine)
+		script.WriteString("if [ \"$dm_alpine\" = yes ]; then\n" + bootstrapUserAlpine + "else\n" + bootstrapUserUseradd + "fi\n")
+	case BootstrapDistroAlpine:
+		script.WriteString(bootstrapUserAlpine)
+	default:
+		script.WriteString(bootstrapUserUseradd)
+	}
+
+	script.WriteString(bootstrapAuthorizedKeys)
+
+	// SELinux context of created .ssh on RHEL family
+	if distro == BootstrapDistroAuto || distro == BootstrapDistroRHEL {
+		script.WriteString("if command -v restorecon >/dev/null 2>&1; then restorecon -R \"$dm_home/.ssh\"; fi\n")
+	}
+
+	script.WriteString(bootstrapSudoers)
+
+	options := make([]string, 0, 2)
+	if cfg.DisablePasswordAuth {
+		options = append(options, "PasswordAuthentication no", "ChallengeResponseAuthentication no")
+	}
+
+	if cfg.DisableRootLogin {
+		options = append(options, "PermitRootLogin no")
+	}
+
+	if len(options) > 0 {
+		script.WriteString("dm_sshd_options=" + shellQuote(strings.Join(options, "\n")+"\n") + "\n")
+		script.WriteString(bootstrapSSHDHardening)
+	}
+
+	return script.String(), nil
+}
+
+// bootstrapDetectAlpine sets dm_alpine by ID and ID_LIKE of /etc/os-release
+const bootstrapDetectAlpine = `dm_os=$( . /etc/os-release 2>/dev/null; echo "$ID $ID_LIKE")
+case "$dm_os" in
+*alpine*) dm_alpine=yes ;;
+*) dm_alpine=no ;;
+esac
+`
+
+// bootstrapUserUseradd creates the user on Debian and RHEL families
+const bootstrapUserUseradd = `id "$dm_user" >/dev/null 2>&1 || useradd -m -s "$dm_shell" "$dm_user"
+`
+
+// BusyBox adduser -D locks the password, sshd of Alpine rejects locked accounts even with a key
+const bootstrapUserAlpine = `command -v sudo >/dev/null 2>&1 || apk add --no-cache sudo
+id "$dm_user" >/dev/null 2>&1 || adduser -D -s "$dm_shell" "$dm_user"
+sed -i "s/^$dm_user:!:/$dm_user:*:/" /etc/shadow
+`
+
+const bootstrapAuthorizedKeys = `dm_home=$(awk -F: -v u="$dm_user" '$1 == u { print $6 }' /etc/passwd)
+mkdir -p "$dm_home/.ssh"
+printf '%s\n' "$dm_keys" > "$dm_home/.ssh/authorized_keys"
+chmod 700 "$dm_home/.ssh"
+chmod 600 "$dm_home/.ssh/authorized_keys"
+chown -R "$dm_user:$(id -gn "$dm_user")" "$dm_home/.ssh"
+`
+
+const bootstrapSudoers = `mkdir -p /etc/sudoers.d
+grep -Eq '^[@#]includedir[[:space:]]+/etc/sudoers.d' /etc/sudoers || echo '#includedir /etc/sudoers.d' >> /etc/sudoers
+dm_sudoers="/etc/sudoers.d/$dm_user"
+printf '%s ALL=(ALL) NOPASSWD:ALL\n' "$dm_user" > "$dm_sudoers.tmp"
+chmod 0440 "$dm_sudoers.tmp"
+if visudo -c -f "$dm_sudoers.tmp" >/dev/null; then
+  mv "$dm_sudoers.tmp" "$dm_sudoers"
+else
+  rm -f "$dm_sudoers.tmp"
+  echo "docker-machine: invalid sudoers rule of $dm_user" >&2
+fi
+`
+
+// sshd uses the first value of an option, so options are put before the rest of the config.
+// Invalid config is rolled back
+const bootstrapSSHDHardening = `if grep -Eiq '^[[:space:]]*Include[[:space:]]+/etc/ssh/sshd_config.d/' /etc/ssh/sshd_config; then
+  dm_sshd_file=/etc/ssh/sshd_config.d/00-docker-machine.conf
+  printf '%s' "$dm_sshd_options" > "$dm_sshd_file"
+  sshd -t || rm -f "$dm_sshd_file"
+else
+  cp /etc/ssh/sshd_config /etc/ssh/sshd_config.docker-machine
+  { printf '%s' "$dm_sshd_options"; cat /etc/ssh/sshd_config.docker-machine; } > /etc/ssh/sshd_config
+  sshd -t || cp /etc/ssh/sshd_config.docker-machine /etc/ssh/sshd_config
+fi
+` + bootstrapSSHDReload
+
+const bootstrapSSHDReload = `systemctl reload sshd 2>/dev/null || systemctl reload ssh 2>/dev/null || rc-service sshd reload 2>/dev/null || true
+`
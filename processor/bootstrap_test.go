@@ -0,0 +1,139 @@
+package processor
+
+import (
+	"flag"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update golden files in testdata")
+
+const (
+	testMachineKey    = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIFhK3v2uDtN2BfAkDxyhn7dvh3C4tUE6Mf/0ZKYYsL0i docker-machine"
+	testAdditionalKey = "ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAAAgQC7 it's ops@example.com"
+)
+
+func TestBuildBootstrapScript(t *testing.T) {
+	hardening := BootstrapConfig{DisablePasswordAuth: true, DisableRootLogin: true}
+
+	tests := []struct {
+		golden string
+		user   string
+		keys   []string
+		cfg    BootstrapConfig
+	}{
+		{golden: "bootstrap_auto", user: "docker", keys: []string{testMachineKey}, cfg: BootstrapConfig{Distro: BootstrapDistroAuto}},
+		{golden: "bootstrap_debian", user: "docker", keys: []string{testMachineKey}, cfg: BootstrapConfig{Distro: BootstrapDistroDebian}},
+		{golden: "bootstrap_rhel", user: "docker", keys: []string{testMachineKey}, cfg: BootstrapConfig{Distro: BootstrapDistroRHEL}},
+		{golden: "bootstrap_alpine", user: "docker", keys: []string{testMachineKey}, cfg: BootstrapConfig{Distro: BootstrapDistroAlpine}},
+		{golden: "bootstrap_auto_hardened", user: "docker", keys: []string{testMachineKey}, cfg: withDistro(hardening, BootstrapDistroAuto)},
+		{golden: "bootstrap_debian_hardened", user: "docker", keys: []string{testMachineKey}, cfg: withDistro(hardening, BootstrapDistroDebian)},
+		{golden: "bootstrap_rhel_hardened", user: "docker", keys: []string{testMachineKey}, cfg: withDistro(hardening, BootstrapDistroRHEL)},
+		{golden: "bootstrap_alpine_hardened", user: "docker", keys: []string{testMachineKey}, cfg: withDistro(hardening, BootstrapDistroAlpine)},
+		{golden: "bootstrap_quoted_key", user: "ops_user-1", keys: []string{testMachineKey, testAdditionalKey}, cfg: BootstrapConfig{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.golden, func(t *testing.T) {
+			script, err := buildBootstrapScript(test.user, test.keys, test.cfg)
+			if err != nil {
+				t.Fatalf("buildBootstrapScript error: %v", err)
+			}
+
+			assertGolden(t, test.golden, script)
+			assertShellSyntax(t, script)
+		})
+	}
+}
+
+func TestBuildBootstrapScriptRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		user string
+		keys []string
+		cfg  BootstrapConfig
+	}{
+		{name: "uppercase user", user: "Docker", keys: []string{testMachineKey}},
+		{name: "user with quote", user: "dock'er", keys: []string{testMachineKey}},
+		{name: "user with command", user: "docker;reboot", keys: []string{testMachineKey}},
+		{name: "empty user", user: "", keys: []string{testMachineKey}},
+		{name: "multi-line key", user: "docker", keys: []string{testMachineKey + "\nssh-ed25519 AAAA injected"}},
+		{name: "key with carriage return", user: "docker", keys: []string{testMachineKey + "\r"}},
+		{name: "no keys", user: "docker"},
+		{name: "unknown distro", user: "docker", keys: []string{testMachineKey}, cfg: BootstrapConfig{Distro: "gentoo"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := buildBootstrapScript(test.user, test.keys, test.cfg); err == nil {
+				t.Fatal("buildBootstrapScript error expected")
+			}
+		})
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh isn't available")
+	}
+
+	values := []string{"docker", "it's", `'"'`, "$(reboot) `id` $HOME \\n", testAdditionalKey, ""}
+
+	for _, value := range values {
+		out, err := exec.Command(sh, "-c", "printf '%s' "+shellQuote(value)).Output()
+		if err != nil {
+			t.Fatalf("sh error for %q: %v", value, err)
+		}
+
+		if string(out) != value {
+			t.Errorf("shellQuote(%q) is read by sh as %q", value, out)
+		}
+	}
+}
+
+func withDistro(cfg BootstrapConfig, distro string) BootstrapConfig {
+	cfg.Distro = distro
+
+	return cfg
+}
+
+// assertGolden compares script with testdata/<name>.golden, -update rewrites the file
+func assertGolden(t *testing.T, name, script string) {
+	t.Helper()
+
+	path := filepath.Join("testdata", name+".golden")
+
+	if *update {
+		if err := os.WriteFile(path, []byte(script), 0644); err != nil {
+			t.Fatalf("WriteFile error: %v", err)
+		}
+
+		return
+	}
+
+	golden, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile error: %v (run go test -update to create it)", err)
+	}
+
+	if string(golden) != script {
+		t.Errorf("script differs from %s (run go test -update to accept)\ngot:\n%s", path, script)
+	}
+}
+
+// assertShellSyntax checks the script with sh -n
+func assertShellSyntax(t *testing.T, script string) {
+	t.Helper()
+
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		return
+	}
+
+	if out, err := exec.Command(sh, "-n", "-c", script).CombinedOutput(); err != nil {
+		t.Errorf("sh -n error: %v: %s", err, out)
+	}
+}
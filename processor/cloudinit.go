@@ -0,0 +1,270 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"mime/multipart"
+	"net/textproto"
+	"os"
+	"strings"
+
+	"github.com/DimKush/docker-driver-vcd/rancher"
+	"github.com/docker/machine/libmachine/log"
+	"github.com/vmware/go-vcloud-director/v2/govcd"
+	"github.com/vmware/go-vcloud-director/v2/types/v56"
+	"gopkg.in/yaml.v2"
+)
+
+// user data delivery modes of vcd-userdata-mode
+const (
+	UserDataModeCustomization = "customization"
+	UserDataModeOVFProperties = "ovf-properties"
+)
+
+// cloudInitConfig is user data of the machine for cloud-init based delivery modes
+type cloudInitConfig struct {
+	Hostname            string
+	SSHKey              string
+	AuthorizedKeys      []string
+	SSHUser             string
+	UserData            string
+	InitData            string
+	Rke2                bool
+	HostPrivateKey      string
+	HostPublicKey       string
+	DisablePasswordAuth bool
+	DisableRootLogin    bool
+	// KeepInstanceCache makes cloud-init keep instance data when the datasource disappears, e.g. ejected seed ISO
+	KeepInstanceCache bool
+}
+
+// publicKeys returns the machine key and additional authorized keys
+func (c cloudInitConfig) publicKeys() []string {
+	return authorizedKeys(c.SSHKey, c.AuthorizedKeys)
+}
+
+// cloudConfigUser is a user entry of cloud-config users module
+type cloudConfigUser struct {
+	Name              string   `yaml:"name"`
+	Shell             string   `yaml:"shell"`
+	Sudo              string   `yaml:"sudo"`
+	SSHAuthorizedKeys []string `yaml:"ssh_authorized_keys"`
+}
+
+// cloudConfigFile is a file entry of cloud-config write_files module
+type cloudConfigFile struct {
+	Path        string `yaml:"path"`
+	Content     string `yaml:"content"`
+	Permissions string `yaml:"permissions"`
+}
+
+type cloudConfig struct {
+	Hostname    string            `yaml:"hostname"`
+	Users       []interface{}     `yaml:"users"`
+	WriteFiles  []cloudConfigFile `yaml:"write_files,omitempty"`
+	SSHPwAuth   *bool             `yaml:"ssh_pwauth,omitempty"`
+	DisableRoot *bool             `yaml:"disable_root,omitempty"`
+	SSHKeys     map[string]string `yaml:"ssh_keys,omitempty"`
+}
+
+type cloudInitMetaData struct {
+	InstanceID    string   `yaml:"instance-id"`
+	LocalHostname string   `yaml:"local-hostname"`
+	PublicKeys    []string `yaml:"public-keys"`
+}
+
+// userScript returns init data and user data of the machine as a shell script.
+// With rke2 user data is a rancher cloud-config, its install script is extracted and started in background
+func userScript(cfg cloudInitConfig) (string, error) {
+	script := cfg.InitData + "\n"
+
+	if !cfg.Rke2 {
+		return script + cfg.UserData, nil
+	}
+
+	readUserData, err := os.ReadFile(cfg.UserData)
+	if err != nil {
+		return "", fmt.Errorf("userScript.ReadFile error: %w", err)
+	}
+
+	cloudInit := rancher.GetCloudInitRancher(string(readUserData))
+
+	script += "mkdir -p /usr/local/custom_script\n"
+	script += "echo '" + cloudInit + "' | base64 -d | gunzip | sudo tee /usr/local/custom_script/install.sh\n"
+	script += "nohup sh /usr/local/custom_script/install.sh > /dev/null 2>&1 &\n"
+	script += "exit 0\n"
+
+	return script, nil
+}
+
+// buildCloudInitUserData returns cloud-config with SSH user of the machine. Init data and user data
+// are added as a shell script part of multipart user data
+func buildCloudInitUserData(cfg cloudInitConfig) (string, error) {
+	var writeFiles []cloudConfigFile
+	if cfg.KeepInstanceCache {
+		// without the cache pinned, the next boot without datasource is a new instance and users and host keys are recreated
+		writeFiles = append(writeFiles, cloudConfigFile{
+			Path:        "/etc/cloud/cloud.cfg.d/99-docker-machine-manual-cache-clean.cfg",
+			Content:     "manual_cache_clean: true\n",
+			Permissions: "0644",
+		})
+	}
+
+	config := cloudConfig{
+		Hostname:   cfg.Hostname,
+		WriteFiles: writeFiles,
+		Users: []interface{}{
+			"default",
+			cloudConfigUser{
+				Name:              cfg.SSHUser,
+				Shell:             "/bin/bash",
+				Sudo:              "ALL=(ALL) NOPASSWD:ALL",
+				SSHAuthorizedKeys: cfg.publicKeys(),
+			},
+		},
+	}
+
+	if cfg.DisablePasswordAuth {
+		pwAuth := false
+		config.SSHPwAuth = &pwAuth
+	}
+
+	if cfg.DisableRootLogin {
+		disableRoot := true
+		config.DisableRoot = &disableRoot
+	}
+
+	// host key generated by the driver replaces the one cloud-init would generate
+	if cfg.HostPrivateKey != "" {
+		config.SSHKeys = map[string]string{
+			"ed25519_private": cfg.HostPrivateKey,
+			"ed25519_public":  strings.TrimSpace(cfg.HostPublicKey),
+		}
+	}
+
+	marshaled, err := yaml.Marshal(config)
+	if err != nil {
+		return "", fmt.Errorf("buildCloudInitUserData.Marshal error: %w", err)
+	}
+
+	cloudConfigPart := "#cloud-config\n" + string(marshaled)
+
+	script, err := userScript(cfg)
+	if err != nil {
+		return "", err
+	}
+
+	if strings.TrimSpace(script) == "" {
+		return cloudConfigPart, nil
+	}
+
+	if !strings.HasPrefix(script, "#!") {
+		script = "#!/bin/sh\n" + script
+	}
+
+	var body bytes.Buffer
+
+	writer := multipart.NewWriter(&body)
+
+	parts := []struct {
+		contentType string
+		content     string
+	}{
+		{contentType: "text/cloud-config", content: cloudConfigPart},
+		{contentType: "text/x-shellscript", content: script},
+	}
+
+	for _, part := range parts {
+		partWriter, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type": {part.contentType + `; charset="utf-8"`},
+		})
+		if err != nil {
+			return "", fmt.Errorf("buildCloudInitUserData.CreatePart error: %w", err)
+		}
+
+		if _, err := partWriter.Write([]byte(part.content)); err != nil {
+			return "", fmt.Errorf("buildCloudInitUserData.Write error: %w", err)
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return "", fmt.Errorf("buildCloudInitUserData.Close error: %w", err)
+	}
+
+	header := fmt.Sprintf("Content-Type: multipart/mixed; boundary=%q\nMIME-Version: 1.0\n\n", writer.Boundary())
+
+	return header + body.String(), nil
+}
+
+// buildCloudInitMetaData returns cloud-init meta-data with hostname and SSH key of the machine
+func buildCloudInitMetaData(cfg cloudInitConfig) (string, error) {
+	metaData, err := yaml.Marshal(cloudInitMetaData{
+		InstanceID:    cfg.Hostname,
+		LocalHostname: cfg.Hostname,
+		PublicKeys:    cfg.publicKeys(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("buildCloudInitMetaData.Marshal error: %w", err)
+	}
+
+	return string(metaData), nil
+}
+
+// applyOVFProperties writes base64 user-data and meta-data to ProductSection of the VM.
+// Existing properties of the template with other keys are kept
+func applyOVFProperties(vm *govcd.VM, cfg cloudInitConfig) error {
+	userData, err := buildCloudInitUserData(cfg)
+	if err != nil {
+		return err
+	}
+
+	metaData, err := buildCloudInitMetaData(cfg)
+	if err != nil {
+		return err
+	}
+
+	productSectionList, err := vm.GetProductSectionList()
+	if err != nil {
+		return fmt.Errorf("applyOVFProperties.GetProductSectionList error: %w", err)
+	}
+
+	if productSectionList.ProductSection == nil {
+		productSectionList.ProductSection = &types.ProductSection{}
+	}
+
+	properties := map[string]string{
+		"instance-id": cfg.Hostname,
+		"hostname":    cfg.Hostname,
+		"public-keys": strings.Join(cfg.publicKeys(), "\n"),
+		"user-data":   base64.StdEncoding.EncodeToString([]byte(userData)),
+		"meta-data":   base64.StdEncoding.EncodeToString([]byte(metaData)),
+	}
+
+	kept := make([]*types.Property, 0, len(productSectionList.ProductSection.Property))
+	for _, property := range productSectionList.ProductSection.Property {
+		if _, ok := properties[property.Key]; !ok {
+			kept = append(kept, property)
+		}
+	}
+
+	for _, key := range []string{"instance-id", "hostname", "public-keys", "user-data", "meta-data"} {
+		kept = append(kept, &types.Property{
+			Key:              key,
+			Type:             "string",
+			DefaultValue:     properties[key],
+			Value:            &types.Value{Value: properties[key]},
+			UserConfigurable: true,
+		})
+	}
+
+	productSectionList.ProductSection.Property = kept
+
+	log.Infof("applyOVFProperties writes cloud-init user-data (%d bytes) and meta-data to VM %s", len(userData), vm.VM.Name)
+
+	if _, err := vm.SetProductSectionList(productSectionList); err != nil {
+		return fmt.Errorf("applyOVFProperties.SetProductSectionList error: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,46 @@
+package processor
+
+import (
+	"fmt"
+
+	"github.com/DimKush/docker-driver-vcd/client"
+	"github.com/vmware/go-vcloud-director/v2/types/v56"
+)
+
+// vmComputePolicy returns references to sizing and placement policies of the client, nil if none is set
+func vmComputePolicy(vcdClient *client.VCloudClient) (*types.ComputePolicy, error) {
+	if vcdClient.SizingPolicy == nil && vcdClient.PlacementPolicy == nil {
+		return nil, nil
+	}
+
+	computePolicy := &types.ComputePolicy{}
+
+	if vcdClient.SizingPolicy != nil {
+		href, err := computePolicyHref(vcdClient, vcdClient.SizingPolicy)
+		if err != nil {
+			return nil, err
+		}
+
+		computePolicy.VmSizingPolicy = &types.Reference{HREF: href}
+	}
+
+	if vcdClient.PlacementPolicy != nil {
+		href, err := computePolicyHref(vcdClient, vcdClient.PlacementPolicy)
+		if err != nil {
+			return nil, err
+		}
+
+		computePolicy.VmPlacementPolicy = &types.Reference{HREF: href}
+	}
+
+	return computePolicy, nil
+}
+
+func computePolicyHref(vcdClient *client.VCloudClient, policy *types.VdcComputePolicy) (string, error) {
+	href, err := vcdClient.Client.Client.OpenApiBuildEndpoint(types.OpenApiPathVersion1_0_0, types.OpenApiEndpointVdcComputePolicies, policy.ID)
+	if err != nil {
+		return "", fmt.Errorf("computePolicyHref of policy %s error: %w", policy.Name, err)
+	}
+
+	return href.String(), nil
+}
@@ -0,0 +1,168 @@
+package processor
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/docker/machine/libmachine/log"
+	"github.com/vmware/go-vcloud-director/v2/govcd"
+	"github.com/vmware/go-vcloud-director/v2/types/v56"
+)
+
+// DataDisk is an additional internal disk of the VM, it's deleted together with the VM
+type DataDisk struct {
+	SizeMb         int64
+	StorageProfile string
+	BusType        string
+}
+
+// diskBusTypes maps bus type names of vcd-data-disk to VCD disk adapter types
+var diskBusTypes = map[string]string{
+	"ide":         "1",
+	"buslogic":    "2",
+	"lsilogic":    "3",
+	"lsilogicsas": "4",
+	"paravirtual": "5",
+	"sata":        "6",
+	"nvme":        "7",
+}
+
+// diskBusLimits is a number of buses and units on a bus for the adapter type
+var diskBusLimits = map[string]struct {
+	buses int
+	units int
+}{
+	"1": {buses: 2, units: 2},
+	"2": {buses: 4, units: 16},
+	"3": {buses: 4, units: 16},
+	"4": {buses: 4, units: 16},
+	"5": {buses: 4, units: 16},
+	"6": {buses: 4, units: 30},
+	"7": {buses: 4, units: 15},
+}
+
+// scsiControllerUnit is a unit number reserved for SCSI controller
+const scsiControllerUnit = 7
+
+// ParseDataDiskSpec parses vcd-data-disk value size_mb[:storage_profile[:bus_type]].
+// Empty storage profile means VM storage profile, empty bus type means bus type of the OS disk
+func ParseDataDiskSpec(spec string) (DataDisk, error) {
+	parts := strings.SplitN(spec, ":", 3)
+
+	size, err := strconv.ParseInt(strings.TrimSpace(parts[0]), 10, 64)
+	if err != nil || size <= 0 {
+		return DataDisk{}, fmt.Errorf("invalid vcd-data-disk %q: size must be a positive number of MB", spec)
+	}
+
+	disk := DataDisk{
+		SizeMb: size,
+	}
+
+	if len(parts) > 1 {
+		disk.StorageProfile = strings.TrimSpace(parts[1])
+	}
+
+	if len(parts) > 2 {
+		disk.BusType = strings.ToLower(strings.TrimSpace(parts[2]))
+
+		if _, ok := diskBusTypes[disk.BusType]; disk.BusType != "" && !ok {
+			names := make([]string, 0, len(diskBusTypes))
+			for name := range diskBusTypes {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+
+			return DataDisk{}, fmt.Errorf("invalid vcd-data-disk %q: unknown bus type %s, expected one of: %s", spec, disk.BusType, strings.Join(names, ", "))
+		}
+	}
+
+	return disk, nil
+}
+
+// appendDataDisks adds data disks to disk settings of the VM spec. Disks are placed on the first free unit
+// of the bus with the requested adapter type
+func appendDataDisks(vdc *govcd.Vdc, diskSection *types.DiskSection, disks []DataDisk) error {
+	if len(disks) == 0 {
+		return nil
+	}
+
+	if diskSection == nil || len(diskSection.DiskSettings) == 0 {
+		return fmt.Errorf("appendDataDisks VM has no OS disk")
+	}
+
+	osDisk := diskSection.DiskSettings[0]
+
+	used := make(map[string]bool)
+	for _, setting := range diskSection.DiskSettings {
+		used[diskSlot(setting.AdapterType, setting.BusNumber, setting.UnitNumber)] = true
+	}
+
+	for _, disk := range disks {
+		adapterType := osDisk.AdapterType
+		if disk.BusType != "" {
+			adapterType = diskBusTypes[disk.BusType]
+		}
+
+		busNumber, unitNumber, err := freeDiskSlot(used, adapterType)
+		if err != nil {
+			return err
+		}
+
+		setting := &types.DiskSettings{
+			SizeMb:      disk.SizeMb,
+			AdapterType: adapterType,
+			BusNumber:   busNumber,
+			UnitNumber:  unitNumber,
+		}
+
+		if disk.StorageProfile != "" {
+			storageProfileRef, err := vdc.FindStorageProfileReference(disk.StorageProfile)
+			if err != nil {
+				return fmt.Errorf("appendDataDisks.FindStorageProfileReference %s error: %w", disk.StorageProfile, err)
+			}
+
+			setting.StorageProfile = &storageProfileRef
+			setting.OverrideVmDefault = true
+		}
+
+		log.Infof("appendDataDisks adds %d MB disk on adapter %s bus %d unit %d", disk.SizeMb, adapterType, busNumber, unitNumber)
+
+		used[diskSlot(adapterType, busNumber, unitNumber)] = true
+		diskSection.DiskSettings = append(diskSection.DiskSettings, setting)
+	}
+
+	return nil
+}
+
+func freeDiskSlot(used map[string]bool, adapterType string) (int, int, error) {
+	limits, ok := diskBusLimits[adapterType]
+	if !ok {
+		return 0, 0, fmt.Errorf("freeDiskSlot unknown disk adapter type %s", adapterType)
+	}
+
+	for bus := 0; bus < limits.buses; bus++ {
+		for unit := 0; unit < limits.units; unit++ {
+			if unit == scsiControllerUnit && limits.units == 16 {
+				continue
+			}
+
+			if !used[diskSlot(adapterType, bus, unit)] {
+				return bus, unit, nil
+			}
+		}
+	}
+
+	return 0, 0, fmt.Errorf("freeDiskSlot no free unit for disk adapter type %s", adapterType)
+}
+
+func diskSlot(adapterType string, bus, unit int) string {
+	return fmt.Sprintf("%s:%d:%d", adapterType, bus, unit)
+}
+
+// isOwnedDisk returns true for internal disks of the VM. They are deleted together with the VM
+// and must not be detached like named (independent) disks
+func isOwnedDisk(setting *types.DiskSettings) bool {
+	return setting.Disk == nil
+}
@@ -0,0 +1,158 @@
+package processor
+
+import (
+	"testing"
+
+	"github.com/vmware/go-vcloud-director/v2/types/v56"
+)
+
+func TestParseDataDiskSpec(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    DataDisk
+		invalid bool
+	}{
+		{spec: "102400", want: DataDisk{SizeMb: 102400}},
+		{spec: "1024:ssd-fast", want: DataDisk{SizeMb: 1024, StorageProfile: "ssd-fast"}},
+		{spec: " 1024 : ssd-fast : ParaVirtual ", want: DataDisk{SizeMb: 1024, StorageProfile: "ssd-fast", BusType: "paravirtual"}},
+		{spec: "1024::nvme", want: DataDisk{SizeMb: 1024, BusType: "nvme"}},
+		{spec: "1024:ssd:", want: DataDisk{SizeMb: 1024, StorageProfile: "ssd"}},
+		{spec: "", invalid: true},
+		{spec: "0", invalid: true},
+		{spec: "-1024", invalid: true},
+		{spec: "10GB", invalid: true},
+		{spec: ":ssd", invalid: true},
+		{spec: "1024:ssd:scsi", invalid: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.spec, func(t *testing.T) {
+			disk, err := ParseDataDiskSpec(test.spec)
+			if test.invalid {
+				if err == nil {
+					t.Fatalf("ParseDataDiskSpec error expected, got %+v", disk)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("ParseDataDiskSpec error: %v", err)
+			}
+
+			if disk != test.want {
+				t.Errorf("ParseDataDiskSpec = %+v, want %+v", disk, test.want)
+			}
+		})
+	}
+}
+
+// usedSlots marks count first slots of the adapter in bus and unit order, without SCSI controller unit
+func usedSlots(adapterType string, count int) map[string]bool {
+	used := make(map[string]bool)
+
+	for count > 0 {
+		bus, unit, err := freeDiskSlot(used, adapterType)
+		if err != nil {
+			break
+		}
+
+		used[diskSlot(adapterType, bus, unit)] = true
+		count--
+	}
+
+	return used
+}
+
+func TestFreeDiskSlot(t *testing.T) {
+	paravirtual := diskBusTypes["paravirtual"]
+	ide := diskBusTypes["ide"]
+	sata := diskBusTypes["sata"]
+
+	tests := []struct {
+		name        string
+		adapterType string
+		used        map[string]bool
+		bus, unit   int
+		full        bool
+	}{
+		{name: "empty controller", adapterType: paravirtual, used: map[string]bool{}, bus: 0, unit: 0},
+		{name: "SCSI controller unit is skipped", adapterType: paravirtual, used: usedSlots(paravirtual, 7), bus: 0, unit: 8},
+		{name: "next SCSI bus", adapterType: paravirtual, used: usedSlots(paravirtual, 15), bus: 1, unit: 0},
+		{name: "gap is reused", adapterType: paravirtual, used: map[string]bool{diskSlot(paravirtual, 0, 1): true}, bus: 0, unit: 0},
+		{name: "other adapter slots are free", adapterType: sata, used: usedSlots(paravirtual, 60), bus: 0, unit: 0},
+		{name: "SATA uses unit 7", adapterType: sata, used: usedSlots(sata, 7), bus: 0, unit: 7},
+		{name: "IDE second bus", adapterType: ide, used: usedSlots(ide, 2), bus: 1, unit: 0},
+		{name: "IDE full", adapterType: ide, used: usedSlots(ide, 4), full: true},
+		{name: "SCSI full", adapterType: paravirtual, used: usedSlots(paravirtual, 60), full: true},
+		{name: "unknown adapter", adapterType: "99", used: map[string]bool{}, full: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			bus, unit, err := freeDiskSlot(test.used, test.adapterType)
+			if test.full {
+				if err == nil {
+					t.Fatalf("freeDiskSlot error expected, got bus %d unit %d", bus, unit)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("freeDiskSlot error: %v", err)
+			}
+
+			if bus != test.bus || unit != test.unit {
+				t.Errorf("freeDiskSlot = bus %d unit %d, want bus %d unit %d", bus, unit, test.bus, test.unit)
+			}
+		})
+	}
+}
+
+func TestAppendDataDisks(t *testing.T) {
+	paravirtual := diskBusTypes["paravirtual"]
+	nvme := diskBusTypes["nvme"]
+
+	section := &types.DiskSection{DiskSettings: []*types.DiskSettings{
+		{SizeMb: 20480, AdapterType: paravirtual, BusNumber: 0, UnitNumber: 0},
+	}}
+
+	// without storage profiles VDC isn't used
+	err := appendDataDisks(nil, section, []DataDisk{{SizeMb: 1024}, {SizeMb: 2048, BusType: "nvme"}, {SizeMb: 4096}})
+	if err != nil {
+		t.Fatalf("appendDataDisks error: %v", err)
+	}
+
+	want := []struct {
+		adapterType string
+		bus, unit   int
+		sizeMb      int64
+	}{
+		{adapterType: paravirtual, bus: 0, unit: 1, sizeMb: 1024},
+		{adapterType: nvme, bus: 0, unit: 0, sizeMb: 2048},
+		{adapterType: paravirtual, bus: 0, unit: 2, sizeMb: 4096},
+	}
+
+	if len(section.DiskSettings) != len(want)+1 {
+		t.Fatalf("appendDataDisks added %d disks, want %d", len(section.DiskSettings)-1, len(want))
+	}
+
+	for i, disk := range want {
+		setting := section.DiskSettings[i+1]
+		if setting.AdapterType != disk.adapterType || setting.BusNumber != disk.bus || setting.UnitNumber != disk.unit || setting.SizeMb != disk.sizeMb {
+			t.Errorf("disk %d = adapter %s bus %d unit %d size %d, want %+v",
+				i, setting.AdapterType, setting.BusNumber, setting.UnitNumber, setting.SizeMb, disk)
+		}
+	}
+
+	if err := appendDataDisks(nil, &types.DiskSection{}, []DataDisk{{SizeMb: 1024}}); err == nil {
+		t.Error("appendDataDisks error expected for VM without OS disk")
+	}
+
+	full := &types.DiskSection{DiskSettings: []*types.DiskSettings{{SizeMb: 20480, AdapterType: diskBusTypes["ide"]}}}
+	disks := []DataDisk{{SizeMb: 1}, {SizeMb: 1}, {SizeMb: 1}, {SizeMb: 1}}
+	if err := appendDataDisks(nil, full, disks); err == nil {
+		t.Error("appendDataDisks error expected when IDE controller is full")
+	}
+}
@@ -0,0 +1,279 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// isoSectorSize is a logical block size of ISO 9660 image
+const isoSectorSize = 2048
+
+// isoFile is a file in the root directory of ISO 9660 image
+type isoFile struct {
+	Name    string
+	Content []byte
+}
+
+// isoLayout is a sector map of the image: system area, primary, Joliet and terminator volume descriptors,
+// L and M path tables of both trees, root directories of both trees and file data
+const (
+	isoPrimaryDescriptorSector = 16
+	isoJolietDescriptorSector  = 17
+	isoTerminatorSector        = 18
+	isoPrimaryPathTableL       = 19
+	isoPrimaryPathTableM       = 20
+	isoJolietPathTableL        = 21
+	isoJolietPathTableM        = 22
+	isoPrimaryRootSector       = 23
+	isoJolietRootSector        = 24
+	isoFirstFileSector         = 25
+)
+
+// buildISO9660 builds ISO 9660 image with files in the root directory. Joliet extension keeps
+// lowercase names with dashes like user-data, primary tree has ISO level 1 names
+func buildISO9660(label string, files []isoFile, now time.Time) ([]byte, error) {
+	sorted := make([]isoFile, len(files))
+	copy(sorted, files)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+
+	extents := make([]uint32, len(sorted))
+	sector := uint32(isoFirstFileSector)
+	for i, file := range sorted {
+		extents[i] = sector
+		sector += isoSectors(len(file.Content))
+	}
+
+	totalSectors := sector
+
+	primaryRoot, err := isoDirectory(isoPrimaryRootSector, sorted, extents, now, isoPrimaryName)
+	if err != nil {
+		return nil, err
+	}
+
+	jolietRoot, err := isoDirectory(isoJolietRootSector, sorted, extents, now, isoJolietName)
+	if err != nil {
+		return nil, err
+	}
+
+	image := make([]byte, int(totalSectors)*isoSectorSize)
+
+	writeSector := func(sector int, data []byte) {
+		copy(image[sector*isoSectorSize:], data)
+	}
+
+	writeSector(isoPrimaryDescriptorSector, isoVolumeDescriptor(1, label, totalSectors, isoPrimaryPathTableL, isoPrimaryPathTableM, isoPrimaryRootSector, now))
+	writeSector(isoJolietDescriptorSector, isoVolumeDescriptor(2, label, totalSectors, isoJolietPathTableL, isoJolietPathTableM, isoJolietRootSector, now))
+	writeSector(isoTerminatorSector, append([]byte{255}, []byte("CD001\x01")...))
+	writeSector(isoPrimaryPathTableL, isoPathTable(isoPrimaryRootSector, binary.LittleEndian))
+	writeSector(isoPrimaryPathTableM, isoPathTable(isoPrimaryRootSector, binary.BigEndian))
+	writeSector(isoJolietPathTableL, isoPathTable(isoJolietRootSector, binary.LittleEndian))
+	writeSector(isoJolietPathTableM, isoPathTable(isoJolietRootSector, binary.BigEndian))
+	writeSector(isoPrimaryRootSector, primaryRoot)
+	writeSector(isoJolietRootSector, jolietRoot)
+
+	for i, file := range sorted {
+		writeSector(int(extents[i]), file.Content)
+	}
+
+	return image, nil
+}
+
+func isoSectors(size int) uint32 {
+	if size == 0 {
+		return 1
+	}
+
+	return uint32((size + isoSectorSize - 1) / isoSectorSize)
+}
+
+// isoPrimaryName converts file name to ISO 9660 level 1 d-characters: NAME.EXT;1
+func isoPrimaryName(name string) []byte {
+	base, ext := name, ""
+	if dot := strings.LastIndex(name, "."); dot >= 0 {
+		base, ext = name[:dot], name[dot+1:]
+	}
+
+	clean := func(value string, limit int) string {
+		var builder strings.Builder
+		for _, r := range strings.ToUpper(value) {
+			if builder.Len() == limit {
+				break
+			}
+
+			if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+				builder.WriteRune(r)
+			} else {
+				builder.WriteRune('_')
+			}
+		}
+
+		return builder.String()
+	}
+
+	return []byte(clean(base, 8) + "." + clean(ext, 3) + ";1")
+}
+
+// isoJolietName encodes file name as UCS-2 big endian
+func isoJolietName(name string) []byte {
+	return isoUCS2(name)
+}
+
+func isoUCS2(value string) []byte {
+	encoded := utf16.Encode([]rune(value))
+	out := make([]byte, 0, len(encoded)*2)
+	for _, char := range encoded {
+		out = append(out, byte(char>>8), byte(char))
+	}
+
+	return out
+}
+
+// isoDirectory returns root directory sector with ".", ".." and file records
+func isoDirectory(rootSector uint32, files []isoFile, extents []uint32, now time.Time, name func(string) []byte) ([]byte, error) {
+	var directory bytes.Buffer
+
+	directory.Write(isoDirectoryRecord([]byte{0}, rootSector, isoSectorSize, true, now))
+	directory.Write(isoDirectoryRecord([]byte{1}, rootSector, isoSectorSize, true, now))
+
+	for i, file := range files {
+		directory.Write(isoDirectoryRecord(name(file.Name), extents[i], uint32(len(file.Content)), false, now))
+	}
+
+	if directory.Len() > isoSectorSize {
+		return nil, fmt.Errorf("isoDirectory %d files don't fit into root directory", len(files))
+	}
+
+	return directory.Bytes(), nil
+}
+
+func isoDirectoryRecord(identifier []byte, extent, size uint32, directory bool, now time.Time) []byte {
+	length := 33 + len(identifier)
+	if len(identifier)%2 == 0 {
+		length++
+	}
+
+	record := make([]byte, length)
+	record[0] = byte(length)
+	isoBothEndian32(record[2:], extent)
+	isoBothEndian32(record[10:], size)
+	copy(record[18:25], isoRecordingDate(now))
+
+	if directory {
+		record[25] = 2
+	}
+
+	isoBothEndian16(record[28:], 1)
+	record[32] = byte(len(identifier))
+	copy(record[33:], identifier)
+
+	return record
+}
+
+// isoVolumeDescriptor returns primary (type 1) or Joliet supplementary (type 2) volume descriptor
+func isoVolumeDescriptor(descriptorType byte, label string, totalSectors, pathTableL, pathTableM, rootSector uint32, now time.Time) []byte {
+	descriptor := make([]byte, isoSectorSize)
+	joliet := descriptorType == 2
+
+	text := func(offset, length int, value string) {
+		field := descriptor[offset : offset+length]
+
+		if !joliet {
+			for i := range field {
+				field[i] = ' '
+			}
+			copy(field, value)
+
+			return
+		}
+
+		for i := 0; i+1 < length; i += 2 {
+			field[i], field[i+1] = 0, ' '
+		}
+		copy(field, isoUCS2(value))
+	}
+
+	descriptor[0] = descriptorType
+	copy(descriptor[1:], "CD001")
+	descriptor[6] = 1
+
+	text(8, 32, "LINUX")
+	text(40, 32, label)
+	isoBothEndian32(descriptor[80:], totalSectors)
+
+	if joliet {
+		// UCS-2 level 3 escape sequence
+		copy(descriptor[88:], "%/E")
+	}
+
+	isoBothEndian16(descriptor[120:], 1)
+	isoBothEndian16(descriptor[124:], 1)
+	isoBothEndian16(descriptor[128:], isoSectorSize)
+	isoBothEndian32(descriptor[132:], uint32(len(isoPathTable(rootSector, binary.LittleEndian))))
+	binary.LittleEndian.PutUint32(descriptor[140:], pathTableL)
+	binary.BigEndian.PutUint32(descriptor[148:], pathTableM)
+	copy(descriptor[156:190], isoDirectoryRecord([]byte{0}, rootSector, isoSectorSize, true, now))
+
+	text(190, 128, "")
+	text(318, 128, "")
+	text(446, 128, "")
+	text(574, 128, "docker-machine-driver-vcd")
+	text(702, 37, "")
+	text(739, 37, "")
+	text(776, 37, "")
+
+	copy(descriptor[813:830], isoVolumeDate(now))
+	copy(descriptor[830:847], isoVolumeDate(now))
+	copy(descriptor[847:864], isoVolumeDate(time.Time{}))
+	copy(descriptor[864:881], isoVolumeDate(time.Time{}))
+	descriptor[881] = 1
+
+	return descriptor
+}
+
+// isoPathTable returns path table with the root directory only
+func isoPathTable(rootSector uint32, order binary.ByteOrder) []byte {
+	table := make([]byte, 10)
+	table[0] = 1
+	order.PutUint32(table[2:], rootSector)
+	order.PutUint16(table[6:], 1)
+
+	return table
+}
+
+func isoRecordingDate(value time.Time) []byte {
+	value = value.UTC()
+
+	return []byte{
+		byte(value.Year() - 1900),
+		byte(value.Month()),
+		byte(value.Day()),
+		byte(value.Hour()),
+		byte(value.Minute()),
+		byte(value.Second()),
+		0,
+	}
+}
+
+// isoVolumeDate returns 17 bytes date of volume descriptor, zero time means "not specified"
+func isoVolumeDate(value time.Time) []byte {
+	if value.IsZero() {
+		return append([]byte("0000000000000000"), 0)
+	}
+
+	return append([]byte(value.UTC().Format("20060102150405")+"00"), 0)
+}
+
+func isoBothEndian16(field []byte, value uint16) {
+	binary.LittleEndian.PutUint16(field, value)
+	binary.BigEndian.PutUint16(field[2:], value)
+}
+
+func isoBothEndian32(field []byte, value uint32) {
+	binary.LittleEndian.PutUint32(field, value)
+	binary.BigEndian.PutUint32(field[4:], value)
+}
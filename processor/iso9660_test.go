@@ -0,0 +1,250 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf16"
+)
+
+// isoRecord is a directory record parsed back from the image
+type isoRecord struct {
+	Name   string
+	Extent uint32
+	Size   uint32
+	Dir    bool
+}
+
+func TestBuildISO9660(t *testing.T) {
+	metaData := []byte("instance-id: docker-machine\nlocal-hostname: docker-machine\n")
+	// user-data spans more than one sector to check extents of the following files
+	userData := []byte("#cloud-config\n" + strings.Repeat("# padding\n", 300))
+
+	image, err := buildISO9660(noCloudVolumeLabel, []isoFile{
+		{Name: "user-data", Content: userData},
+		{Name: "meta-data", Content: metaData},
+	}, time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("buildISO9660 error: %v", err)
+	}
+
+	if len(image)%isoSectorSize != 0 {
+		t.Fatalf("image size %d isn't a multiple of sector size", len(image))
+	}
+
+	metaSectors := isoSectors(len(metaData))
+	wantExtents := map[string]uint32{
+		"meta-data": isoFirstFileSector,
+		"user-data": isoFirstFileSector + metaSectors,
+	}
+	wantTotal := isoFirstFileSector + metaSectors + isoSectors(len(userData))
+	contents := map[string][]byte{"meta-data": metaData, "user-data": userData}
+
+	if got := uint32(len(image) / isoSectorSize); got != wantTotal {
+		t.Fatalf("image has %d sectors, want %d", got, wantTotal)
+	}
+
+	terminator := isoTestSector(t, image, isoTerminatorSector)
+	if terminator[0] != 255 || string(terminator[1:6]) != "CD001" {
+		t.Fatalf("sector %d isn't a volume descriptor set terminator", isoTerminatorSector)
+	}
+
+	trees := []struct {
+		name       string
+		sector     int
+		kind       byte
+		rootSector uint32
+		label      string
+		names      map[string]string
+	}{
+		{
+			name:       "primary",
+			sector:     isoPrimaryDescriptorSector,
+			kind:       1,
+			rootSector: isoPrimaryRootSector,
+			label:      "cidata",
+			names:      map[string]string{"META_DAT.;1": "meta-data", "USER_DAT.;1": "user-data"},
+		},
+		{
+			name:       "joliet",
+			sector:     isoJolietDescriptorSector,
+			kind:       2,
+			rootSector: isoJolietRootSector,
+			label:      "cidata",
+			names:      map[string]string{"meta-data": "meta-data", "user-data": "user-data"},
+		},
+	}
+
+	for _, tree := range trees {
+		t.Run(tree.name, func(t *testing.T) {
+			joliet := tree.kind == 2
+			descriptor := isoTestSector(t, image, tree.sector)
+
+			if descriptor[0] != tree.kind || string(descriptor[1:6]) != "CD001" || descriptor[6] != 1 {
+				t.Fatalf("sector %d isn't a volume descriptor of type %d", tree.sector, tree.kind)
+			}
+
+			if joliet && string(descriptor[88:91]) != "%/E" {
+				t.Errorf("escape sequence = %q, want %%/E", descriptor[88:91])
+			}
+
+			if label := isoTestText(descriptor[40:72], joliet); label != tree.label {
+				t.Errorf("volume ID = %q, want %q", label, tree.label)
+			}
+
+			if total := isoTestBothEndian32(t, descriptor[80:88]); total != wantTotal {
+				t.Errorf("volume space size = %d, want %d", total, wantTotal)
+			}
+
+			root := isoTestRecord(t, descriptor[156:190], joliet)
+			if !root.Dir || root.Extent != tree.rootSector || root.Size != isoSectorSize {
+				t.Fatalf("root directory record = %+v, want extent %d", root, tree.rootSector)
+			}
+
+			records := isoTestDirectory(t, isoTestSector(t, image, int(root.Extent)), joliet)
+			if len(records) != 2+len(tree.names) {
+				t.Fatalf("root directory has %d records, want %d", len(records), 2+len(tree.names))
+			}
+
+			for _, record := range records[2:] {
+				file, ok := tree.names[record.Name]
+				if !ok {
+					t.Errorf("unexpected file %q in root directory", record.Name)
+					continue
+				}
+
+				if record.Dir {
+					t.Errorf("%s is a directory", record.Name)
+				}
+
+				if record.Extent != wantExtents[file] {
+					t.Errorf("%s extent = %d, want %d", record.Name, record.Extent, wantExtents[file])
+				}
+
+				if record.Size != uint32(len(contents[file])) {
+					t.Errorf("%s size = %d, want %d", record.Name, record.Size, len(contents[file]))
+				}
+
+				start := int(record.Extent) * isoSectorSize
+				end := start + int(record.Size)
+				if end > len(image) {
+					t.Fatalf("%s ends at %d beyond the image of %d bytes", record.Name, end, len(image))
+				}
+
+				if !bytes.Equal(image[start:end], contents[file]) {
+					t.Errorf("%s content doesn't match", record.Name)
+				}
+			}
+		})
+	}
+}
+
+func TestBuildISO9660DirectoryOverflow(t *testing.T) {
+	files := make([]isoFile, 100)
+	for i := range files {
+		files[i] = isoFile{Name: strings.Repeat("f", 40) + string(rune('a'+i%26)) + strings.Repeat("x", i/26)}
+	}
+
+	if _, err := buildISO9660(noCloudVolumeLabel, files, time.Now()); err == nil {
+		t.Fatal("expected error for files not fitting into root directory")
+	}
+}
+
+func TestISOPrimaryName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "meta-data", want: "META_DAT.;1"},
+		{name: "user-data", want: "USER_DAT.;1"},
+		{name: "network-config", want: "NETWORK_.;1"},
+		{name: "vendor.data.yaml", want: "VENDOR_D.YAM;1"},
+	}
+
+	for _, test := range tests {
+		if got := string(isoPrimaryName(test.name)); got != test.want {
+			t.Errorf("isoPrimaryName(%q) = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func isoTestSector(t *testing.T, image []byte, sector int) []byte {
+	t.Helper()
+
+	start := sector * isoSectorSize
+	if start+isoSectorSize > len(image) {
+		t.Fatalf("sector %d is beyond the image of %d bytes", sector, len(image))
+	}
+
+	return image[start : start+isoSectorSize]
+}
+
+// isoTestDirectory parses directory records of a single sector directory
+func isoTestDirectory(t *testing.T, sector []byte, joliet bool) []isoRecord {
+	t.Helper()
+
+	var records []isoRecord
+	for offset := 0; offset < len(sector) && sector[offset] != 0; offset += int(sector[offset]) {
+		records = append(records, isoTestRecord(t, sector[offset:], joliet))
+	}
+
+	return records
+}
+
+func isoTestRecord(t *testing.T, data []byte, joliet bool) isoRecord {
+	t.Helper()
+
+	length := int(data[0])
+	if length < 34 || length > len(data) {
+		t.Fatalf("directory record length %d is invalid", length)
+	}
+
+	nameLength := int(data[32])
+	if 33+nameLength > length {
+		t.Fatalf("directory record identifier length %d exceeds record length %d", nameLength, length)
+	}
+
+	if data[28] != 1 || data[31] != 1 {
+		t.Errorf("volume sequence number of record isn't 1")
+	}
+
+	identifier := data[33 : 33+nameLength]
+	name := string(identifier)
+	if joliet && nameLength > 1 {
+		name = isoTestText(identifier, true)
+	}
+
+	return isoRecord{
+		Name:   name,
+		Extent: isoTestBothEndian32(t, data[2:10]),
+		Size:   isoTestBothEndian32(t, data[10:18]),
+		Dir:    data[25]&2 != 0,
+	}
+}
+
+// isoTestText decodes d-characters or UCS-2 big endian text padded with spaces
+func isoTestText(field []byte, joliet bool) string {
+	if !joliet {
+		return strings.TrimRight(string(field), " ")
+	}
+
+	chars := make([]uint16, 0, len(field)/2)
+	for i := 0; i+1 < len(field); i += 2 {
+		chars = append(chars, binary.BigEndian.Uint16(field[i:]))
+	}
+
+	return strings.TrimRight(string(utf16.Decode(chars)), " ")
+}
+
+func isoTestBothEndian32(t *testing.T, field []byte) uint32 {
+	t.Helper()
+
+	little, big := binary.LittleEndian.Uint32(field), binary.BigEndian.Uint32(field[4:])
+	if little != big {
+		t.Fatalf("both-endian field mismatch: little %d, big %d", little, big)
+	}
+
+	return little
+}
@@ -0,0 +1,48 @@
+package processor
+
+import (
+	"fmt"
+
+	"github.com/DimKush/docker-driver-vcd/client"
+	"github.com/vmware/go-vcloud-director/v2/govcd"
+	"github.com/vmware/go-vcloud-director/v2/types/v56"
+)
+
+// machineNetworks returns org VDC networks of all NICs of the machine
+func machineNetworks(vcdClient *client.VCloudClient) []*types.OrgVDCNetwork {
+	networks := make([]*types.OrgVDCNetwork, 0, len(vcdClient.Networks))
+	for _, network := range vcdClient.Networks {
+		networks = append(networks, network.OrgVDCNetwork)
+	}
+
+	if len(networks) == 0 && vcdClient.Network != nil {
+		networks = append(networks, vcdClient.Network.OrgVDCNetwork)
+	}
+
+	return networks
+}
+
+// missingVAppNetworks returns networks which are not in network config of the vApp yet
+func missingVAppNetworks(vApp *govcd.VApp, networks []*types.OrgVDCNetwork) ([]*types.OrgVDCNetwork, error) {
+	networkConfig, err := vApp.GetNetworkConfig()
+	if err != nil {
+		return nil, fmt.Errorf("missingVAppNetworks.GetNetworkConfig error: %w", err)
+	}
+
+	existing := make(map[string]struct{}, len(networkConfig.NetworkConfig))
+	for _, config := range networkConfig.NetworkConfig {
+		existing[config.NetworkName] = struct{}{}
+	}
+
+	missing := make([]*types.OrgVDCNetwork, 0)
+	for _, network := range networks {
+		if _, ok := existing[network.Name]; ok {
+			continue
+		}
+
+		existing[network.Name] = struct{}{}
+		missing = append(missing, network)
+	}
+
+	return missing, nil
+}
@@ -0,0 +1,198 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/DimKush/docker-driver-vcd/client"
+	"github.com/docker/machine/libmachine/log"
+	"github.com/vmware/go-vcloud-director/v2/govcd"
+	"github.com/vmware/go-vcloud-director/v2/types/v56"
+)
+
+// UserDataModeNoCloudISO delivers cloud-init user-data and meta-data on NoCloud seed ISO inserted as VM media
+const UserDataModeNoCloudISO = "nocloud-iso"
+
+const (
+	// noCloudVolumeLabel is a volume label cloud-init looks for NoCloud datasource
+	noCloudVolumeLabel = "cidata"
+
+	noCloudMediaSuffix      = "-cidata"
+	noCloudUploadPieceSize  = 1024 * 1024
+	noCloudUploadPollPeriod = time.Second
+)
+
+// noCloudMediaName returns catalog media name of the seed ISO of the machine
+func noCloudMediaName(machineName string) string {
+	return machineName + noCloudMediaSuffix
+}
+
+// buildNoCloudISO returns NoCloud seed ISO image with user-data and meta-data of the machine
+func buildNoCloudISO(cfg cloudInitConfig) ([]byte, error) {
+	cfg.KeepInstanceCache = true
+
+	userData, err := buildCloudInitUserData(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	metaData, err := buildCloudInitMetaData(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return buildISO9660(noCloudVolumeLabel, []isoFile{
+		{Name: "meta-data", Content: []byte(metaData)},
+		{Name: "user-data", Content: []byte(userData)},
+	}, time.Now())
+}
+
+// attachNoCloudMedia uploads seed ISO of the machine to the catalog and inserts it into the VM.
+// Media with the same name left by previous create is replaced
+func attachNoCloudMedia(vcdClient *client.VCloudClient, catalogName string, vm *govcd.VM, cfg cloudInitConfig) error {
+	image, err := buildNoCloudISO(cfg)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp("", "docker-machine-cidata-*.iso")
+	if err != nil {
+		return fmt.Errorf("attachNoCloudMedia.CreateTemp error: %w", err)
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.Write(image); err != nil {
+		file.Close()
+		return fmt.Errorf("attachNoCloudMedia.Write error: %w", err)
+	}
+
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("attachNoCloudMedia.Close error: %w", err)
+	}
+
+	catalog, err := vcdClient.Org.GetCatalogByName(catalogName, true)
+	if err != nil {
+		return fmt.Errorf("attachNoCloudMedia.GetCatalogByName error: %w", err)
+	}
+
+	mediaName := noCloudMediaName(vm.VM.Name)
+
+	if err := deleteNoCloudMedia(catalog, mediaName); err != nil {
+		return err
+	}
+
+	log.Infof("attachNoCloudMedia uploads seed ISO %s (%d bytes) to catalog %s", mediaName, len(image), catalogName)
+
+	uploadTask, err := catalog.UploadMediaImage(mediaName, "cloud-init NoCloud seed of docker-machine "+vm.VM.Name, file.Name(), noCloudUploadPieceSize)
+	if err != nil {
+		return fmt.Errorf("attachNoCloudMedia.UploadMediaImage error: %w", err)
+	}
+
+	for uploadTask.GetUploadProgress() != "100.00" {
+		if err := uploadTask.GetUploadError(); err != nil {
+			return fmt.Errorf("attachNoCloudMedia upload of %s error: %w", mediaName, err)
+		}
+
+		time.Sleep(noCloudUploadPollPeriod)
+	}
+
+	if err := uploadTask.WaitTaskCompletion(); err != nil {
+		return fmt.Errorf("attachNoCloudMedia.WaitTaskCompletion error: %w", err)
+	}
+
+	media, err := catalog.GetMediaByName(mediaName, true)
+	if err != nil {
+		return fmt.Errorf("attachNoCloudMedia.GetMediaByName error: %w", err)
+	}
+
+	task, err := vm.InsertMedia(noCloudMediaParams(media))
+	if err != nil {
+		return fmt.Errorf("attachNoCloudMedia.InsertMedia error: %w", err)
+	}
+
+	if err := task.WaitTaskCompletion(); err != nil {
+		return fmt.Errorf("attachNoCloudMedia.InsertMedia.WaitTaskCompletion error: %w", err)
+	}
+
+	return nil
+}
+
+// ejectNoCloudMedia ejects seed ISO from the VM and deletes it from the catalog
+func ejectNoCloudMedia(vcdClient *client.VCloudClient, catalogName string, vm *govcd.VM) error {
+	catalog, err := vcdClient.Org.GetCatalogByName(catalogName, true)
+	if err != nil {
+		return fmt.Errorf("ejectNoCloudMedia.GetCatalogByName error: %w", err)
+	}
+
+	mediaName := noCloudMediaName(vm.VM.Name)
+
+	media, err := catalog.GetMediaByName(mediaName, true)
+	if err != nil {
+		if errors.Is(err, govcd.ErrorEntityNotFound) {
+			return nil
+		}
+
+		return fmt.Errorf("ejectNoCloudMedia.GetMediaByName error: %w", err)
+	}
+
+	log.Infof("ejectNoCloudMedia ejects seed ISO %s from VM %s", mediaName, vm.VM.Name)
+
+	// guest may lock the tray, the question is answered to force eject
+	task, err := vm.EjectMedia(noCloudMediaParams(media))
+	if err != nil {
+		return fmt.Errorf("ejectNoCloudMedia.EjectMedia error: %w", err)
+	}
+
+	if err := task.WaitTaskCompletion(true); err != nil {
+		return fmt.Errorf("ejectNoCloudMedia.EjectMedia.WaitTaskCompletion error: %w", err)
+	}
+
+	return deleteNoCloudMedia(catalog, mediaName)
+}
+
+// removeNoCloudMedia deletes seed ISO of the machine from the catalog, missing media isn't an error
+func removeNoCloudMedia(vcdClient *client.VCloudClient, catalogName, machineName string) error {
+	catalog, err := vcdClient.Org.GetCatalogByName(catalogName, true)
+	if err != nil {
+		return fmt.Errorf("removeNoCloudMedia.GetCatalogByName error: %w", err)
+	}
+
+	return deleteNoCloudMedia(catalog, noCloudMediaName(machineName))
+}
+
+func deleteNoCloudMedia(catalog *govcd.Catalog, mediaName string) error {
+	media, err := catalog.GetMediaByName(mediaName, true)
+	if err != nil {
+		if errors.Is(err, govcd.ErrorEntityNotFound) {
+			return nil
+		}
+
+		return fmt.Errorf("deleteNoCloudMedia.GetMediaByName error: %w", err)
+	}
+
+	log.Infof("deleteNoCloudMedia deletes seed ISO %s from catalog %s", mediaName, catalog.Catalog.Name)
+
+	task, err := media.Delete()
+	if err != nil {
+		return fmt.Errorf("deleteNoCloudMedia.Delete error: %w", err)
+	}
+
+	if err := task.WaitTaskCompletion(); err != nil {
+		return fmt.Errorf("deleteNoCloudMedia.Delete.WaitTaskCompletion error: %w", err)
+	}
+
+	return nil
+}
+
+func noCloudMediaParams(media *govcd.Media) *types.MediaInsertOrEjectParams {
+	return &types.MediaInsertOrEjectParams{
+		Media: &types.Reference{
+			HREF: media.Media.HREF,
+			Name: media.Media.Name,
+			ID:   media.Media.ID,
+			Type: media.Media.Type,
+		},
+	}
+}
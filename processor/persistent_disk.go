@@ -0,0 +1,249 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/docker/machine/libmachine/log"
+	"github.com/vmware/go-vcloud-director/v2/govcd"
+	"github.com/vmware/go-vcloud-director/v2/types/v56"
+)
+
+// PersistentDiskDescription marks independent disks created by the driver,
+// vcd-tool finds orphaned persistent disks by this description prefix
+const PersistentDiskDescription = "docker-machine persistent disk"
+
+// PersistentDisk is a named independent disk which survives machine re-creation
+type PersistentDisk struct {
+	Name   string
+	SizeMb int64
+}
+
+// PersistentDiskInfo describes a persistent disk in VDC for vcd-tool
+type PersistentDiskInfo struct {
+	Disk       *govcd.Disk
+	AttachedTo string
+}
+
+// ParsePersistentDiskSpec parses vcd-persistent-disk value name:size_mb
+func ParsePersistentDiskSpec(spec string) (PersistentDisk, error) {
+	parts := strings.SplitN(spec, ":", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+		return PersistentDisk{}, fmt.Errorf("invalid vcd-persistent-disk %q, expected name:size_mb", spec)
+	}
+
+	size, err := strconv.ParseInt(strings.TrimSpace(parts[1]), 10, 64)
+	if err != nil || size <= 0 {
+		return PersistentDisk{}, fmt.Errorf("invalid vcd-persistent-disk %q: size must be a positive number of MB", spec)
+	}
+
+	return PersistentDisk{
+		Name:   strings.TrimSpace(parts[0]),
+		SizeMb: size,
+	}, nil
+}
+
+// ensurePersistentDisk returns existing persistent disk by name or creates a new one
+func ensurePersistentDisk(vdc *govcd.Vdc, storageProfile types.Reference, spec PersistentDisk, machineName string) (*govcd.Disk, error) {
+	disk, err := findPersistentDisk(vdc, spec.Name)
+	if err != nil && !errors.Is(err, govcd.ErrorEntityNotFound) {
+		return nil, err
+	}
+
+	if disk != nil {
+		attached, errAttached := disk.AttachedVM()
+		if errAttached != nil {
+			return nil, fmt.Errorf("ensurePersistentDisk.AttachedVM error: %w", errAttached)
+		}
+
+		if attached != nil {
+			return nil, fmt.Errorf("persistent disk %s is attached to VM %s", spec.Name, attached.Name)
+		}
+
+		if disk.Disk.SizeMb != spec.SizeMb {
+			log.Warnf("ensurePersistentDisk disk %s has size %d MB instead of %d MB, existing disk is reused", spec.Name, disk.Disk.SizeMb, spec.SizeMb)
+		}
+
+		log.Infof("ensurePersistentDisk reuses existing disk %s", spec.Name)
+
+		return disk, nil
+	}
+
+	log.Infof("ensurePersistentDisk creates disk %s with size %d MB", spec.Name, spec.SizeMb)
+
+	task, err := vdc.CreateDisk(&types.DiskCreateParams{
+		Disk: &types.Disk{
+			Name:           spec.Name,
+			SizeMb:         spec.SizeMb,
+			Description:    PersistentDiskDescription + " of " + machineName,
+			StorageProfile: &storageProfile,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ensurePersistentDisk.CreateDisk error: %w", err)
+	}
+
+	if err := task.WaitTaskCompletion(); err != nil {
+		return nil, fmt.Errorf("ensurePersistentDisk.CreateDisk.WaitTaskCompletion error: %w", err)
+	}
+
+	return findPersistentDisk(vdc, spec.Name)
+}
+
+// findPersistentDisk returns independent disk by name. Names of persistent disks must be unique in VDC
+func findPersistentDisk(vdc *govcd.Vdc, name string) (*govcd.Disk, error) {
+	disks, err := vdc.GetDisksByName(name, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(*disks) > 1 {
+		return nil, fmt.Errorf("found %d independent disks with name %s, persistent disk name must be unique", len(*disks), name)
+	}
+
+	return &(*disks)[0], nil
+}
+
+// attachPersistentDisk attaches independent disk to powered off VM
+func attachPersistentDisk(vm *govcd.VM, disk *govcd.Disk) error {
+	log.Infof("attachPersistentDisk attaches disk %s to VM %s", disk.Disk.Name, vm.VM.Name)
+
+	task, err := vm.AttachDisk(&types.DiskAttachOrDetachParams{
+		Disk: &types.Reference{
+			HREF: disk.Disk.HREF,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("attachPersistentDisk.AttachDisk error: %w", err)
+	}
+
+	if err := task.WaitTaskCompletion(); err != nil {
+		return fmt.Errorf("attachPersistentDisk.WaitTaskCompletion error: %w", err)
+	}
+
+	return nil
+}
+
+// ListPersistentDisks returns independent disks of VDC created by the driver
+func ListPersistentDisks(vdc *govcd.Vdc) ([]PersistentDiskInfo, error) {
+	if err := vdc.Refresh(); err != nil {
+		return nil, fmt.Errorf("ListPersistentDisks.Refresh error: %w", err)
+	}
+
+	disks := make([]PersistentDiskInfo, 0)
+
+	for _, resourceEntities := range vdc.Vdc.ResourceEntities {
+		for _, resourceEntity := range resourceEntities.ResourceEntity {
+			if resourceEntity.Type != types.MimeDisk {
+				continue
+			}
+
+			disk, err := vdc.GetDiskByHref(resourceEntity.HREF)
+			if err != nil {
+				return nil, fmt.Errorf("ListPersistentDisks.GetDiskByHref %s error: %w", resourceEntity.Name, err)
+			}
+
+			if !strings.HasPrefix(disk.Disk.Description, PersistentDiskDescription) {
+				continue
+			}
+
+			info := PersistentDiskInfo{
+				Disk: disk,
+			}
+
+			attached, err := disk.AttachedVM()
+			if err != nil {
+				return nil, fmt.Errorf("ListPersistentDisks.AttachedVM %s error: %w", disk.Disk.Name, err)
+			}
+
+			if attached != nil {
+				info.AttachedTo = attached.Name
+			}
+
+			disks = append(disks, info)
+		}
+	}
+
+	return disks, nil
+}
+
+// detachIndependentDisks detaches named disks from powered off VM before it's deleted.
+// Persistent disk of the machine is deleted only if deletePersistent is set, internal disks are deleted with the VM
+func detachIndependentDisks(vdc *govcd.Vdc, vm *govcd.VM, persistentDisk string, deletePersistent bool) error {
+	if vm.VM.VmSpecSection == nil || vm.VM.VmSpecSection.DiskSection == nil {
+		return nil
+	}
+
+	for _, diskSpec := range vm.VM.VmSpecSection.DiskSection.DiskSettings {
+		if isOwnedDisk(diskSpec) {
+			log.Infof("detachIndependentDisks internal disk with id %s is deleted with VM", diskSpec.DiskId)
+			continue
+		}
+
+		log.Infof("detachIndependentDisks detaches disk with id %s, name: %s", diskSpec.DiskId, diskSpec.Disk.Name)
+
+		task, err := vm.DetachDisk(&types.DiskAttachOrDetachParams{
+			Disk: &types.Reference{
+				HREF: diskSpec.Disk.HREF,
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("detachIndependentDisks.DetachDisk error: %w", err)
+		}
+
+		if err := task.WaitTaskCompletion(); err != nil {
+			return fmt.Errorf("detachIndependentDisks.DetachDisk.WaitTaskCompletion error: %w", err)
+		}
+
+		if persistentDisk == "" {
+			continue
+		}
+
+		disk, err := vdc.GetDiskByHref(diskSpec.Disk.HREF)
+		if err != nil {
+			return fmt.Errorf("detachIndependentDisks.GetDiskByHref error: %w", err)
+		}
+
+		if disk.Disk.Name != persistentDisk {
+			continue
+		}
+
+		if !deletePersistent {
+			log.Infof("detachIndependentDisks keeps persistent disk %s", persistentDisk)
+			continue
+		}
+
+		if err := deleteIndependentDisk(disk); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deleteIndependentDisk deletes detached independent disk
+func deleteIndependentDisk(disk *govcd.Disk) error {
+	log.Infof("deleteIndependentDisk deletes disk %s", disk.Disk.Name)
+
+	task, err := disk.Delete()
+	if err != nil {
+		return fmt.Errorf("deleteIndependentDisk.Delete error: %w", err)
+	}
+
+	if err := task.WaitTaskCompletion(); err != nil {
+		return fmt.Errorf("deleteIndependentDisk.WaitTaskCompletion error: %w", err)
+	}
+
+	return nil
+}
+
+// DeletePersistentDisk deletes persistent disk which is not attached to any VM
+func DeletePersistentDisk(info PersistentDiskInfo) error {
+	if info.AttachedTo != "" {
+		return fmt.Errorf("persistent disk %s is attached to VM %s", info.Disk.Disk.Name, info.AttachedTo)
+	}
+
+	return deleteIndependentDisk(info.Disk)
+}
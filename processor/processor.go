@@ -23,19 +23,37 @@ type Processor interface {
 	Restart() error
 	Start() error
 	GetState() (state.State, error)
+	Resize() error
+	FinishCustomization() error
+	Cleanup() error
 	cleanState() error
 }
 
 type ConfigProcessor struct {
-	VAppName       string
-	VMachineName   string
-	CPUCount       int
-	MemorySize     int64
-	DiskSize       int64
-	EdgeGateway    string
-	PublicIP       string
-	VdcEdgeGateway string
-	Org            string
-	VAppID         string
-	VMachineID     string
+	VAppName             string
+	VMachineName         string
+	CPUCount             int
+	CoresPerSocket       int
+	CPUReservation       int64
+	CPULimit             int64
+	CPUShares            string
+	CPUHotAdd            bool
+	MemorySize           int64
+	MemoryReservation    int64
+	MemoryLimit          int64
+	MemoryShares         string
+	MemoryHotAdd         bool
+	DiskSize             int64
+	DataDisks            []DataDisk
+	PersistentDisk       PersistentDisk
+	DeletePersistentDisk bool
+	UserDataMode         string
+	Bootstrap            BootstrapConfig
+	Catalog              string
+	EdgeGateway          string
+	PublicIP             string
+	VdcEdgeGateway       string
+	Org                  string
+	VAppID               string
+	VMachineID           string
 }
@@ -0,0 +1,138 @@
+package processor
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/DimKush/docker-driver-vcd/client"
+	"github.com/docker/machine/libmachine/log"
+	"github.com/vmware/go-vcloud-director/v2/govcd"
+	"github.com/vmware/go-vcloud-director/v2/types/v56"
+)
+
+// resizeVM applies CPU, memory and OS disk size of the config to existing VM.
+// Powered on VM is powered off only if the change can't be hot added, and powered on again afterwards
+func resizeVM(vcdClient *client.VCloudClient, vm *govcd.VM, cfg ConfigProcessor) error {
+	if vm.VM.VmSpecSection == nil || vm.VM.VmSpecSection.DiskSection == nil || len(vm.VM.VmSpecSection.DiskSection.DiskSettings) == 0 {
+		return fmt.Errorf("resizeVM VM %s has no spec section", vm.VM.Name)
+	}
+
+	current := vm.VM.VmSpecSection
+
+	if cfg.DiskSize < current.DiskSection.DiskSettings[0].SizeMb {
+		return fmt.Errorf("resizeVM OS disk of VM %s can't shrink from %d MB to %d MB", vm.VM.Name, current.DiskSection.DiskSettings[0].SizeMb, cfg.DiskSize)
+	}
+
+	capabilities, err := vmCapabilities(vcdClient, vm)
+	if err != nil {
+		return err
+	}
+
+	needsPowerOff := cpuNeedsPowerOff(current, cfg, capabilities.CPUHotAddEnabled) ||
+		memoryNeedsPowerOff(current, cfg, capabilities.MemoryHotAddEnabled)
+
+	status, err := vm.GetStatus()
+	if err != nil {
+		return fmt.Errorf("resizeVM.GetStatus error: %w", err)
+	}
+
+	poweredOff := false
+
+	if needsPowerOff && status != "POWERED_OFF" {
+		log.Infof("resizeVM VM %s is powered off, hot add is not available for the change", vm.VM.Name)
+
+		task, errPowerOff := vm.PowerOff()
+		if errPowerOff != nil {
+			return fmt.Errorf("resizeVM.PowerOff error: %w", errPowerOff)
+		}
+
+		if err := task.WaitTaskCompletion(); err != nil {
+			return fmt.Errorf("resizeVM.PowerOff.WaitTaskCompletion error: %w", err)
+		}
+
+		poweredOff = true
+	}
+
+	if err := vm.Refresh(); err != nil {
+		return fmt.Errorf("resizeVM.Refresh error: %w", err)
+	}
+
+	vmSpecs := *vm.VM.VmSpecSection
+
+	if err := applySizing(&vmSpecs, cfg, vcdClient.SizingPolicy); err != nil {
+		return fmt.Errorf("resizeVM.applySizing error: %w", err)
+	}
+
+	log.Infof("resizeVM VM %s cpu count: %d, memory: %d MB, disk: %d MB", vm.VM.Name, cfg.CPUCount, cfg.MemorySize, cfg.DiskSize)
+
+	if _, err := vm.UpdateVmSpecSection(&vmSpecs, vm.VM.Description); err != nil {
+		return fmt.Errorf("resizeVM.UpdateVmSpecSection error: %w", err)
+	}
+
+	if !poweredOff {
+		return nil
+	}
+
+	task, err := vm.PowerOn()
+	if err != nil {
+		return fmt.Errorf("resizeVM.PowerOn error: %w", err)
+	}
+
+	if err := task.WaitTaskCompletion(); err != nil {
+		return fmt.Errorf("resizeVM.PowerOn.WaitTaskCompletion error: %w", err)
+	}
+
+	return nil
+}
+
+// vmCapabilities returns hot add capabilities of the VM, they are not a part of VM representation
+func vmCapabilities(vcdClient *client.VCloudClient, vm *govcd.VM) (*types.VmCapabilities, error) {
+	capabilities := &types.VmCapabilities{}
+
+	_, err := vcdClient.Client.Client.ExecuteRequest(
+		vm.VM.HREF+"/vmCapabilities",
+		http.MethodGet,
+		types.MimeVmCapabilities,
+		"error retrieving VM capabilities: %s",
+		nil,
+		capabilities,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("vmCapabilities of VM %s error: %w", vm.VM.Name, err)
+	}
+
+	return capabilities, nil
+}
+
+// cpuNeedsPowerOff returns true if CPU change can't be applied to running VM.
+// Hot add can only increase CPU count and doesn't change cores per socket
+func cpuNeedsPowerOff(current *types.VmSpecSection, cfg ConfigProcessor, hotAdd bool) bool {
+	if current.NumCpus == nil || current.NumCoresPerSocket == nil {
+		return true
+	}
+
+	coresPerSocket := cfg.CPUCount
+	if cfg.CoresPerSocket > 0 {
+		coresPerSocket = cfg.CoresPerSocket
+	}
+
+	if cfg.CPUCount == *current.NumCpus && coresPerSocket == *current.NumCoresPerSocket {
+		return false
+	}
+
+	return !hotAdd || cfg.CPUCount < *current.NumCpus || coresPerSocket != *current.NumCoresPerSocket
+}
+
+// memoryNeedsPowerOff returns true if memory change can't be applied to running VM.
+// Hot add can only increase memory
+func memoryNeedsPowerOff(current *types.VmSpecSection, cfg ConfigProcessor, hotAdd bool) bool {
+	if current.MemoryResourceMb == nil {
+		return true
+	}
+
+	if cfg.MemorySize == current.MemoryResourceMb.Configured {
+		return false
+	}
+
+	return !hotAdd || cfg.MemorySize < current.MemoryResourceMb.Configured
+}
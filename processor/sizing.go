@@ -0,0 +1,139 @@
+package processor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/docker/machine/libmachine/log"
+	"github.com/vmware/go-vcloud-director/v2/govcd"
+	"github.com/vmware/go-vcloud-director/v2/types/v56"
+)
+
+// shares levels of CPU and memory resources, a number means CUSTOM shares
+const (
+	sharesLevelLow    = "LOW"
+	sharesLevelNormal = "NORMAL"
+	sharesLevelHigh   = "HIGH"
+	sharesLevelCustom = "CUSTOM"
+)
+
+// ParseShares parses vcd-cpu-shares and vcd-memory-shares value: LOW, NORMAL, HIGH or a number of custom shares
+func ParseShares(value string) (string, *int, error) {
+	level := strings.ToUpper(strings.TrimSpace(value))
+
+	switch level {
+	case "":
+		return "", nil, nil
+	case sharesLevelLow, sharesLevelNormal, sharesLevelHigh:
+		return level, nil, nil
+	}
+
+	shares, err := strconv.Atoi(level)
+	if err != nil || shares <= 0 {
+		return "", nil, fmt.Errorf("invalid shares %q, expected %s, %s, %s or a positive number", value, sharesLevelLow, sharesLevelNormal, sharesLevelHigh)
+	}
+
+	return sharesLevelCustom, &shares, nil
+}
+
+// applySizing sets CPU topology, memory, OS disk size and resource allocation of the config to VM spec.
+// Zero reservation and limit keep values of the template. Values defined by the sizing policy are kept as is
+func applySizing(vmSpecs *types.VmSpecSection, cfg ConfigProcessor, sizingPolicy *types.VdcComputePolicy) error {
+	cpuCount := cfg.CPUCount
+	coresPerSocket := cfg.CPUCount
+	if cfg.CoresPerSocket > 0 {
+		coresPerSocket = cfg.CoresPerSocket
+	}
+
+	if coresPerSocket <= 0 || cpuCount%coresPerSocket != 0 {
+		return fmt.Errorf("applySizing cores per socket %d doesn't divide cpu count %d", coresPerSocket, cpuCount)
+	}
+
+	if sizingPolicy == nil || sizingPolicy.CPUCount == nil {
+		vmSpecs.NumCpus = &cpuCount
+	}
+
+	if sizingPolicy == nil || sizingPolicy.CoresPerSocket == nil {
+		vmSpecs.NumCoresPerSocket = &coresPerSocket
+	}
+
+	if vmSpecs.MemoryResourceMb == nil {
+		vmSpecs.MemoryResourceMb = &types.MemoryResourceMb{}
+	}
+
+	if sizingPolicy == nil || sizingPolicy.Memory == nil {
+		vmSpecs.MemoryResourceMb.Configured = cfg.MemorySize
+	}
+
+	vmSpecs.DiskSection.DiskSettings[0].SizeMb = cfg.DiskSize
+
+	if cfg.CPUReservation > 0 || cfg.CPULimit != 0 || cfg.CPUShares != "" {
+		if vmSpecs.CpuResourceMhz == nil {
+			vmSpecs.CpuResourceMhz = &types.CpuResourceMhz{}
+		}
+
+		cpu := vmSpecs.CpuResourceMhz
+
+		if cfg.CPUReservation > 0 {
+			reservation := cfg.CPUReservation
+			cpu.Reservation = &reservation
+		}
+
+		if cfg.CPULimit != 0 {
+			limit := cfg.CPULimit
+			cpu.Limit = &limit
+		}
+
+		level, shares, err := ParseShares(cfg.CPUShares)
+		if err != nil {
+			return err
+		}
+
+		if level != "" {
+			cpu.SharesLevel = level
+			cpu.Shares = shares
+		}
+	}
+
+	if cfg.MemoryReservation > 0 || cfg.MemoryLimit != 0 || cfg.MemoryShares != "" {
+		memory := vmSpecs.MemoryResourceMb
+
+		if cfg.MemoryReservation > 0 {
+			reservation := cfg.MemoryReservation
+			memory.Reservation = &reservation
+		}
+
+		if cfg.MemoryLimit != 0 {
+			limit := cfg.MemoryLimit
+			memory.Limit = &limit
+		}
+
+		level, shares, err := ParseShares(cfg.MemoryShares)
+		if err != nil {
+			return err
+		}
+
+		if level != "" {
+			memory.SharesLevel = level
+			memory.Shares = shares
+		}
+	}
+
+	return nil
+}
+
+// applyHotAdd enables CPU and memory hot add. Hot add is a VM capability, it's not a part of VmSpecSection
+func applyHotAdd(vm *govcd.VM, cfg ConfigProcessor) error {
+	if !cfg.CPUHotAdd && !cfg.MemoryHotAdd {
+		return nil
+	}
+
+	log.Infof("applyHotAdd VM %s cpu hot add: %t, memory hot add: %t", vm.VM.Name, cfg.CPUHotAdd, cfg.MemoryHotAdd)
+
+	if _, err := vm.UpdateVmCpuAndMemoryHotAdd(cfg.CPUHotAdd, cfg.MemoryHotAdd); err != nil {
+		return fmt.Errorf("applyHotAdd.UpdateVmCpuAndMemoryHotAdd error: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,225 @@
+package processor
+
+import (
+	"testing"
+
+	"github.com/vmware/go-vcloud-director/v2/types/v56"
+)
+
+func TestParseShares(t *testing.T) {
+	tests := []struct {
+		value   string
+		level   string
+		shares  int
+		invalid bool
+	}{
+		{value: "", level: ""},
+		{value: "low", level: sharesLevelLow},
+		{value: " Normal ", level: sharesLevelNormal},
+		{value: "HIGH", level: sharesLevelHigh},
+		{value: "2500", level: sharesLevelCustom, shares: 2500},
+		{value: "0", invalid: true},
+		{value: "-10", invalid: true},
+		{value: "CUSTOM", invalid: true},
+		{value: "medium", invalid: true},
+		{value: "1.5", invalid: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			level, shares, err := ParseShares(test.value)
+			if test.invalid {
+				if err == nil {
+					t.Fatalf("ParseShares error expected, got %s", level)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("ParseShares error: %v", err)
+			}
+
+			if level != test.level {
+				t.Errorf("ParseShares level = %q, want %q", level, test.level)
+			}
+
+			switch {
+			case test.shares == 0 && shares != nil:
+				t.Errorf("ParseShares shares = %d, want none", *shares)
+			case test.shares != 0 && (shares == nil || *shares != test.shares):
+				t.Errorf("ParseShares shares = %v, want %d", shares, test.shares)
+			}
+		})
+	}
+}
+
+func intPtr(value int) *int {
+	return &value
+}
+
+func int64Ptr(value int64) *int64 {
+	return &value
+}
+
+// templateSpec is VM spec of a template with 1 CPU, 1024 MB memory and 10 GB disk
+func templateSpec() *types.VmSpecSection {
+	return &types.VmSpecSection{
+		NumCpus:           intPtr(1),
+		NumCoresPerSocket: intPtr(1),
+		MemoryResourceMb:  &types.MemoryResourceMb{Configured: 1024, Reservation: int64Ptr(256)},
+		DiskSection:       &types.DiskSection{DiskSettings: []*types.DiskSettings{{SizeMb: 10240}}},
+	}
+}
+
+func TestApplySizing(t *testing.T) {
+	base := ConfigProcessor{CPUCount: 4, MemorySize: 4096, DiskSize: 20480}
+
+	withConfig := func(change func(cfg *ConfigProcessor)) ConfigProcessor {
+		cfg := base
+		change(&cfg)
+
+		return cfg
+	}
+
+	tests := []struct {
+		name   string
+		cfg    ConfigProcessor
+		policy *types.VdcComputePolicy
+		check  func(t *testing.T, spec *types.VmSpecSection)
+	}{
+		{
+			name: "all cores in one socket",
+			cfg:  base,
+			check: func(t *testing.T, spec *types.VmSpecSection) {
+				expectInt(t, "NumCpus", spec.NumCpus, 4)
+				expectInt(t, "NumCoresPerSocket", spec.NumCoresPerSocket, 4)
+				expectInt64(t, "memory", spec.MemoryResourceMb.Configured, 4096)
+				expectInt64(t, "disk", spec.DiskSection.DiskSettings[0].SizeMb, 20480)
+				expectInt64Ptr(t, "template memory reservation", spec.MemoryResourceMb.Reservation, 256)
+
+				if spec.CpuResourceMhz != nil {
+					t.Errorf("CpuResourceMhz = %+v, want template value", spec.CpuResourceMhz)
+				}
+			},
+		},
+		{
+			name: "cores per socket",
+			cfg:  withConfig(func(cfg *ConfigProcessor) { cfg.CoresPerSocket = 2 }),
+			check: func(t *testing.T, spec *types.VmSpecSection) {
+				expectInt(t, "NumCpus", spec.NumCpus, 4)
+				expectInt(t, "NumCoresPerSocket", spec.NumCoresPerSocket, 2)
+			},
+		},
+		{
+			name:   "sizing policy CPU and memory are kept",
+			cfg:    withConfig(func(cfg *ConfigProcessor) { cfg.CoresPerSocket = 2 }),
+			policy: &types.VdcComputePolicy{CPUCount: intPtr(8), CoresPerSocket: intPtr(4), Memory: intPtr(8192)},
+			check: func(t *testing.T, spec *types.VmSpecSection) {
+				expectInt(t, "NumCpus", spec.NumCpus, 1)
+				expectInt(t, "NumCoresPerSocket", spec.NumCoresPerSocket, 1)
+				expectInt64(t, "memory", spec.MemoryResourceMb.Configured, 1024)
+				expectInt64(t, "disk", spec.DiskSection.DiskSettings[0].SizeMb, 20480)
+			},
+		},
+		{
+			name:   "sizing policy with memory only",
+			cfg:    base,
+			policy: &types.VdcComputePolicy{Memory: intPtr(8192)},
+			check: func(t *testing.T, spec *types.VmSpecSection) {
+				expectInt(t, "NumCpus", spec.NumCpus, 4)
+				expectInt(t, "NumCoresPerSocket", spec.NumCoresPerSocket, 4)
+				expectInt64(t, "memory", spec.MemoryResourceMb.Configured, 1024)
+			},
+		},
+		{
+			name: "resource allocation",
+			cfg: withConfig(func(cfg *ConfigProcessor) {
+				cfg.CPUReservation = 1000
+				cfg.CPULimit = -1
+				cfg.CPUShares = "high"
+				cfg.MemoryReservation = 2048
+				cfg.MemoryLimit = 4096
+				cfg.MemoryShares = "3000"
+			}),
+			check: func(t *testing.T, spec *types.VmSpecSection) {
+				expectInt64Ptr(t, "CPU reservation", spec.CpuResourceMhz.Reservation, 1000)
+				expectInt64Ptr(t, "CPU limit", spec.CpuResourceMhz.Limit, -1)
+				expectString(t, "CPU shares level", spec.CpuResourceMhz.SharesLevel, sharesLevelHigh)
+
+				if spec.CpuResourceMhz.Shares != nil {
+					t.Errorf("CPU shares = %d, want none", *spec.CpuResourceMhz.Shares)
+				}
+
+				expectInt64Ptr(t, "memory reservation", spec.MemoryResourceMb.Reservation, 2048)
+				expectInt64Ptr(t, "memory limit", spec.MemoryResourceMb.Limit, 4096)
+				expectString(t, "memory shares level", spec.MemoryResourceMb.SharesLevel, sharesLevelCustom)
+				expectInt(t, "memory shares", spec.MemoryResourceMb.Shares, 3000)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			spec := templateSpec()
+
+			if err := applySizing(spec, test.cfg, test.policy); err != nil {
+				t.Fatalf("applySizing error: %v", err)
+			}
+
+			test.check(t, spec)
+		})
+	}
+}
+
+func TestApplySizingErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  ConfigProcessor
+	}{
+		{name: "cores per socket doesn't divide cpu count", cfg: ConfigProcessor{CPUCount: 6, CoresPerSocket: 4, MemorySize: 1024, DiskSize: 10240}},
+		{name: "zero cpu count", cfg: ConfigProcessor{MemorySize: 1024, DiskSize: 10240}},
+		{name: "invalid cpu shares", cfg: ConfigProcessor{CPUCount: 2, CPUShares: "max", MemorySize: 1024, DiskSize: 10240}},
+		{name: "invalid memory shares", cfg: ConfigProcessor{CPUCount: 2, MemoryShares: "-5", MemorySize: 1024, DiskSize: 10240}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := applySizing(templateSpec(), test.cfg, nil); err == nil {
+				t.Fatal("applySizing error expected")
+			}
+		})
+	}
+}
+
+func expectInt(t *testing.T, name string, value *int, want int) {
+	t.Helper()
+
+	if value == nil || *value != want {
+		t.Errorf("%s = %v, want %d", name, value, want)
+	}
+}
+
+func expectInt64(t *testing.T, name string, value, want int64) {
+	t.Helper()
+
+	if value != want {
+		t.Errorf("%s = %d, want %d", name, value, want)
+	}
+}
+
+func expectInt64Ptr(t *testing.T, name string, value *int64, want int64) {
+	t.Helper()
+
+	if value == nil || *value != want {
+		t.Errorf("%s = %v, want %d", name, value, want)
+	}
+}
+
+func expectString(t *testing.T, name, value, want string) {
+	t.Helper()
+
+	if value != want {
+		t.Errorf("%s = %q, want %q", name, value, want)
+	}
+}
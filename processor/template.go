@@ -0,0 +1,48 @@
+package processor
+
+import (
+	"net/http"
+
+	"github.com/DimKush/docker-driver-vcd/client"
+	"github.com/docker/machine/libmachine/log"
+	"github.com/vmware/go-vcloud-director/v2/govcd"
+	"github.com/vmware/go-vcloud-director/v2/types/v56"
+)
+
+// addVMFromTemplate adds template VM of the client to vApp. govcd AddNewVM always takes the first VM
+// of the template and sets only sizing policy, so vApp is recomposed directly
+func addVMFromTemplate(vcdClient *client.VCloudClient, vApp *govcd.VApp, name string) (govcd.Task, error) {
+	computePolicy, err := vmComputePolicy(vcdClient)
+	if err != nil {
+		return govcd.Task{}, err
+	}
+
+	log.Infof("addVMFromTemplate adds VM %s to vApp %s from template VM %s", name, vApp.VApp.Name, vcdClient.TemplateVM.HREF)
+
+	composition := &types.ReComposeVAppParams{
+		Ovf:         types.XMLNamespaceOVF,
+		Xsi:         types.XMLNamespaceXSI,
+		Xmlns:       types.XMLNamespaceVCloud,
+		Name:        vApp.VApp.Name,
+		Description: vApp.VApp.Description,
+		SourcedItem: &types.SourcedCompositionItemParam{
+			Source: &types.Reference{
+				HREF: vcdClient.TemplateVM.HREF,
+				Name: name,
+			},
+			InstantiationParams: &types.InstantiationParams{
+				NetworkConnectionSection: vcdClient.TemplateVM.NetworkConnectionSection,
+			},
+			ComputePolicy: computePolicy,
+		},
+		AllEULAsAccepted: true,
+	}
+
+	return vcdClient.Client.Client.ExecuteTaskRequest(
+		vApp.VApp.HREF+"/action/recomposeVApp",
+		http.MethodPost,
+		types.MimeRecomposeVappParams,
+		"error adding VM from template: %s",
+		composition,
+	)
+}
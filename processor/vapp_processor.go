@@ -23,13 +23,27 @@ type VAppProcessor struct {
 }
 
 type CustomScriptConfigVAppProcessor struct {
-	VAppName string
-	SSHKey   string
-	SSHUser  string
-	UserData string
-	InitData string
-	Rke2     bool
-	RootAuth bool
+	VAppName       string
+	SSHKey         string
+	AuthorizedKeys []string
+	HostPrivateKey string
+	HostPublicKey  string
+	SSHUser        string
+	UserData       string
+	InitData       string
+	Rke2           bool
+	RootAuth       bool
+}
+
+// String hides the guest host private key, the config is logged
+func (c CustomScriptConfigVAppProcessor) String() string {
+	if c.HostPrivateKey != "" {
+		c.HostPrivateKey = redactedValue
+	}
+
+	type plain CustomScriptConfigVAppProcessor
+
+	return fmt.Sprintf("%+v", plain(c))
 }
 
 func NewVAppProcessor(client *client.VCloudClient, cfg ConfigProcessor) Processor {
@@ -54,8 +68,7 @@ func (p *VAppProcessor) Create(customCfg interface{}) (*govcd.VApp, error) {
 	}()
 
 	// creates networks instances
-	networks := make([]*types.OrgVDCNetwork, 0)
-	networks = append(networks, p.vcdClient.Network.OrgVDCNetwork)
+	networks := machineNetworks(p.vcdClient)
 
 	// creates template vApp
 	log.Debugf("VAppProcessor.Create creates new vApp and VM instead with single name %s", p.cfg.VAppName)
@@ -94,12 +107,7 @@ func (p *VAppProcessor) Create(customCfg interface{}) (*govcd.VApp, error) {
 	}
 
 	// create a new VM with a SAME name as vApp
-	task, err := vApp.AddNewVM(
-		p.cfg.VAppName,
-		p.vcdClient.VAppTemplate,
-		p.vcdClient.VAppTemplate.VAppTemplate.Children.VM[0].NetworkConnectionSection,
-		true,
-	)
+	task, err := addVMFromTemplate(p.vcdClient, vApp, p.cfg.VAppName)
 	if err != nil {
 		log.Errorf("VAppProcessor.Create.AddNewVM error: %v", err)
 		return nil, err
@@ -170,7 +178,34 @@ func (p *VAppProcessor) Create(customCfg interface{}) (*govcd.VApp, error) {
 	}
 
 	// set custom configs if it's not empty
-	if customCfg != nil {
+	switch {
+	case customCfg == nil:
+	case p.cfg.UserDataMode == UserDataModeOVFProperties:
+		var cloudInit cloudInitConfig
+
+		cloudInit, err = p.cloudInitConfig(customCfg)
+		if err != nil {
+			return nil, fmt.Errorf("VAppProcessor.Create.cloudInitConfig error: %w", err)
+		}
+
+		err = applyOVFProperties(virtualMachine, cloudInit)
+		if err != nil {
+			return nil, fmt.Errorf("VAppProcessor.Create.applyOVFProperties error: %w", err)
+		}
+	case p.cfg.UserDataMode == UserDataModeNoCloudISO:
+		var cloudInit cloudInitConfig
+
+		cloudInit, err = p.cloudInitConfig(customCfg)
+		if err != nil {
+			return nil, fmt.Errorf("VAppProcessor.Create.cloudInitConfig error: %w", err)
+		}
+
+		// seed ISO must be inserted before the first power on, cloud-init reads it once
+		err = attachNoCloudMedia(p.vcdClient, p.cfg.Catalog, virtualMachine, cloudInit)
+		if err != nil {
+			return nil, fmt.Errorf("VAppProcessor.Create.attachNoCloudMedia error: %w", err)
+		}
+	default:
 		var guestSection types.GuestCustomizationSection
 		guestSection, err = p.prepareCustomSectionForVM(*virtualMachine.VM.GuestCustomizationSection, customCfg)
 		if err != nil {
@@ -391,6 +426,8 @@ func (p *VAppProcessor) Remove() error {
 		return err
 	}
 
+	p.removeNoCloudMedia()
+
 	return nil
 }
 
@@ -522,21 +559,86 @@ func (p *VAppProcessor) GetState() (state.State, error) {
 	return state.None, nil
 }
 
+// Resize applies CPU, memory and OS disk size of the config to the machine VM
+func (p *VAppProcessor) Resize() error {
+	log.Debugf("VAppProcessor.Resize running with config: %+v", p.cfg)
+
+	vApp, err := p.vcdClient.VirtualDataCenter.GetVAppById(p.cfg.VAppID, true)
+	if err != nil {
+		log.Errorf("VAppProcessor.Resize.GetVAppById error: %v", err)
+		return err
+	}
+
+	virtualMachine, err := vApp.GetVMByName(p.cfg.VAppName, true)
+	if err != nil {
+		log.Errorf("VAppProcessor.Resize.GetVMByName error: %v", err)
+		return err
+	}
+
+	if err := resizeVM(p.vcdClient, virtualMachine, p.cfg); err != nil {
+		log.Errorf("VAppProcessor.Resize.resizeVM error: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// FinishCustomization ejects and deletes NoCloud seed ISO after the first boot of the machine
+func (p *VAppProcessor) FinishCustomization() error {
+	if p.cfg.UserDataMode != UserDataModeNoCloudISO {
+		return nil
+	}
+
+	vApp, err := p.vcdClient.VirtualDataCenter.GetVAppByName(p.cfg.VAppName, true)
+	if err != nil {
+		log.Errorf("VAppProcessor.FinishCustomization.GetVAppByName error: %v", err)
+		return err
+	}
+
+	virtualMachine, err := vApp.GetVMByName(p.cfg.VAppName, true)
+	if err != nil {
+		log.Errorf("VAppProcessor.FinishCustomization.GetVMByName error: %v", err)
+		return err
+	}
+
+	if err := ejectNoCloudMedia(p.vcdClient, p.cfg.Catalog, virtualMachine); err != nil {
+		log.Errorf("VAppProcessor.FinishCustomization.ejectNoCloudMedia error: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// removeNoCloudMedia deletes NoCloud seed ISO left in the catalog when the vApp is deleted
+func (p *VAppProcessor) removeNoCloudMedia() {
+	if p.cfg.UserDataMode != UserDataModeNoCloudISO {
+		return
+	}
+
+	if err := removeNoCloudMedia(p.vcdClient, p.cfg.Catalog, p.cfg.VAppName); err != nil {
+		log.Errorf("VAppProcessor.removeNoCloudMedia error: %v", err)
+	}
+}
+
 func (p *VAppProcessor) vmPostSettings(vm *govcd.VM) error {
 	log.Debugf("VAppProcessor.vmPostSettings running with custom config: %+v", p.cfg)
 
-	var numCPUsPtr *int
+	// hot add is enabled before the spec update, so later resize doesn't need power off
+	if err := applyHotAdd(vm, p.cfg); err != nil {
+		return fmt.Errorf("VAppProcessor.vmPostSettings.applyHotAdd error: %w", err)
+	}
 
 	// config VM
-	cpuCount := p.cfg.CPUCount
-	numCPUsPtr = &cpuCount
-
 	vmSpecs := *vm.VM.VmSpecSection
 
-	vmSpecs.NumCpus = numCPUsPtr
-	vmSpecs.NumCoresPerSocket = numCPUsPtr
-	vmSpecs.MemoryResourceMb.Configured = p.cfg.MemorySize
-	vmSpecs.DiskSection.DiskSettings[0].SizeMb = p.cfg.DiskSize
+	if err := applySizing(&vmSpecs, p.cfg, p.vcdClient.SizingPolicy); err != nil {
+		return fmt.Errorf("VAppProcessor.vmPostSettings.applySizing error: %w", err)
+	}
+
+	// data disks are added in the same reconfiguration before VM is powered on
+	if err := appendDataDisks(p.vcdClient.VirtualDataCenter, vmSpecs.DiskSection, p.cfg.DataDisks); err != nil {
+		return fmt.Errorf("VAppProcessor.vmPostSettings.appendDataDisks error: %w", err)
+	}
 
 	_, err := vm.UpdateVmSpecSection(&vmSpecs, vm.VM.Description)
 	if err != nil {
@@ -546,6 +648,28 @@ func (p *VAppProcessor) vmPostSettings(vm *govcd.VM) error {
 	return nil
 }
 
+// cloudInitConfig returns user data of custom script config for cloud-init based user data modes
+func (p *VAppProcessor) cloudInitConfig(customCfg interface{}) (cloudInitConfig, error) {
+	cfg, ok := customCfg.(CustomScriptConfigVAppProcessor)
+	if !ok {
+		return cloudInitConfig{}, fmt.Errorf("VAppProcessor.cloudInitConfig invalid config type: %T", customCfg)
+	}
+
+	return cloudInitConfig{
+		Hostname:            cfg.VAppName,
+		SSHKey:              cfg.SSHKey,
+		AuthorizedKeys:      cfg.AuthorizedKeys,
+		HostPrivateKey:      cfg.HostPrivateKey,
+		HostPublicKey:       cfg.HostPublicKey,
+		SSHUser:             cfg.SSHUser,
+		UserData:            cfg.UserData,
+		InitData:            cfg.InitData,
+		Rke2:                cfg.Rke2,
+		DisablePasswordAuth: p.cfg.Bootstrap.DisablePasswordAuth,
+		DisableRootLogin:    p.cfg.Bootstrap.DisableRootLogin,
+	}, nil
+}
+
 func (p *VAppProcessor) prepareCustomSectionForVM(
 	vmScript types.GuestCustomizationSection,
 	customCfg interface{},
@@ -568,9 +692,16 @@ func (p *VAppProcessor) prepareCustomSectionForVM(
 
 	section.AdminPasswordEnabled = &cfg.RootAuth
 
-	scriptSh = cfg.InitData + "\n"
-	// append ssh user to script
-	scriptSh += "\nuseradd -m -d /home/" + cfg.SSHUser + " -s /bin/bash " + cfg.SSHUser + "\nmkdir -p /home/" + cfg.SSHUser + "/.ssh\nchmod 700 /home/" + cfg.SSHUser + "/.ssh\ntouch /home/" + cfg.SSHUser + "/.ssh/authorized_keys\nchmod 600 /home/" + cfg.SSHUser + "/.ssh/authorized_keys\necho \"" + strings.TrimSpace(cfg.SSHKey) + "\" > /home/" + cfg.SSHUser + "/.ssh/authorized_keys\necho \"" + cfg.SSHUser + "     ALL=(ALL) NOPASSWD:ALL\" >>  /etc/sudoers\nchown -R " + cfg.SSHUser + ". -R /home/" + cfg.SSHUser + "\n"
+	bootstrap, err := buildBootstrapScript(cfg.SSHUser, authorizedKeys(cfg.SSHKey, cfg.AuthorizedKeys), p.cfg.Bootstrap)
+	if err != nil {
+		return types.GuestCustomizationSection{}, fmt.Errorf("VAppProcessor.prepareCustomSectionForVM.buildBootstrapScript error: %w", err)
+	}
+
+	scriptSh = cfg.InitData + "\n" + bootstrap
+
+	if cfg.HostPrivateKey != "" {
+		scriptSh += buildHostKeyScript(cfg.HostPrivateKey, cfg.HostPublicKey)
+	}
 
 	if cfg.Rke2 {
 		// if rke2
@@ -600,6 +731,11 @@ func (p *VAppProcessor) prepareCustomSectionForVM(
 	return section, nil
 }
 
+// Cleanup removes vApp and VM of the machine after Create failed in the driver
+func (p *VAppProcessor) Cleanup() error {
+	return p.cleanState()
+}
+
 func (p *VAppProcessor) cleanState() error {
 	log.Debugf("VAppProcessor.cleanState running with config: %+v", p.cfg)
 
@@ -701,6 +837,8 @@ func (p *VAppProcessor) cleanState() error {
 		return err
 	}
 
+	p.removeNoCloudMedia()
+
 	log.Debugf("VAppProcessor.cleanState %s...", p.cfg.VAppName)
 
 	return nil
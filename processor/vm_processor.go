@@ -46,14 +46,28 @@ type VMProcessor struct {
 	VAppID    string
 }
 type CustomScriptConfigVMProcessor struct {
-	VAppName    string
-	MachineName string
-	SSHKey      string
-	SSHUser     string
-	UserData    string
-	InitData    string
-	Rke2        bool
-	RootAuth    bool
+	VAppName       string
+	MachineName    string
+	SSHKey         string
+	AuthorizedKeys []string
+	HostPrivateKey string
+	HostPublicKey  string
+	SSHUser        string
+	UserData       string
+	InitData       string
+	Rke2           bool
+	RootAuth       bool
+}
+
+// String hides the guest host private key, the config is logged
+func (c CustomScriptConfigVMProcessor) String() string {
+	if c.HostPrivateKey != "" {
+		c.HostPrivateKey = redactedValue
+	}
+
+	type plain CustomScriptConfigVMProcessor
+
+	return fmt.Sprintf("%+v", plain(c))
 }
 
 func NewVMProcessor(client *client.VCloudClient, cfg ConfigProcessor) Processor {
@@ -74,17 +88,21 @@ func (p *VMProcessor) checkVAppExistsAndCreateIfNot() (*govcd.VApp, error) {
 		}
 	}
 
-	// if exists, do nothing
+	// creates networks instances
+	networks := machineNetworks(p.vcdClient)
+
+	// if exists, only add networks which the vApp doesn't have yet
 	if vAppExist != nil {
+		if err := p.addMissingVAppNetworks(vAppExist, networks); err != nil {
+			log.Errorf("VMProcessor.checkVAppExistsAndCreateIfNot.addMissingVAppNetworks error: %v", err)
+			return nil, err
+		}
+
 		return vAppExist, nil
 	}
 
 	log.Infof("VMProcessor.checkVAppExistsAndCreateIfNot VApp %s doesn't exist. Creates new vApp", p.cfg.VAppName)
 
-	// creates networks instances
-	networks := make([]*types.OrgVDCNetwork, 0)
-	networks = append(networks, p.vcdClient.Network.OrgVDCNetwork)
-
 	// create a new vApp
 	vApp, err := p.vcdClient.VirtualDataCenter.CreateRawVApp(p.cfg.VAppName, "Container Host created with Docker Host by VMProcessor")
 	if err != nil {
@@ -107,6 +125,34 @@ func (p *VMProcessor) checkVAppExistsAndCreateIfNot() (*govcd.VApp, error) {
 	return vApp, nil
 }
 
+// addMissingVAppNetworks adds networks of the machine NICs to the network config of existing vApp
+func (p *VMProcessor) addMissingVAppNetworks(vApp *govcd.VApp, networks []*types.OrgVDCNetwork) error {
+	missing, err := missingVAppNetworks(vApp, networks)
+	if err != nil {
+		return err
+	}
+
+	if len(missing) == 0 {
+		return nil
+	}
+
+	for _, network := range missing {
+		log.Infof("VMProcessor.addMissingVAppNetworks adds network %s to vApp %s", network.Name, p.cfg.VAppName)
+	}
+
+	// vApp network config can't be changed while other tasks are running
+	if err := p.endlessWaitAllVAppTasksBaclkoff(); err != nil {
+		return err
+	}
+
+	taskNet, err := vApp.AddRAWNetworkConfig(missing)
+	if err != nil {
+		return fmt.Errorf("VMProcessor.addMissingVAppNetworks.AddRAWNetworkConfig error: %w", err)
+	}
+
+	return p.WaitReadyVAppAndRunTask(vApp, taskNet)
+}
+
 func (p *VMProcessor) Create(customCfg interface{}) (*govcd.VApp, error) {
 	log.Infof("VMProcessor.Create running with config: %+v", p.cfg)
 
@@ -158,21 +204,11 @@ func (p *VMProcessor) Create(customCfg interface{}) (*govcd.VApp, error) {
 		return nil, err
 	}
 
-	task, errVM := vApp.AddNewVM(
-		p.cfg.VMachineName,
-		p.vcdClient.VAppTemplate,
-		p.vcdClient.VAppTemplate.VAppTemplate.Children.VM[0].NetworkConnectionSection,
-		true,
-	)
+	task, errVM := addVMFromTemplate(p.vcdClient, vApp, p.cfg.VMachineName)
 	if errVM != nil {
 		log.Errorf("VMProcessor.Create.AddNewVM error => go to loop: %v", p.cfg.VMachineName)
 		waitingFunc := func() error {
-			task, errVM = vApp.AddNewVM(
-				p.cfg.VMachineName,
-				p.vcdClient.VAppTemplate,
-				p.vcdClient.VAppTemplate.VAppTemplate.Children.VM[0].NetworkConnectionSection,
-				true,
-			)
+			task, errVM = addVMFromTemplate(p.vcdClient, vApp, p.cfg.VMachineName)
 			if errVM != nil {
 				return fmt.Errorf("VMProcessor.Create.AddNewVM error => retry create VM: %v", p.cfg.VMachineName)
 			}
@@ -243,8 +279,51 @@ func (p *VMProcessor) Create(customCfg interface{}) (*govcd.VApp, error) {
 		return nil, err
 	}
 
+	// persistent disk is created once and reattached when the machine is created again
+	if p.cfg.PersistentDisk.Name != "" {
+		var disk *govcd.Disk
+		disk, err = ensurePersistentDisk(p.vcdClient.VirtualDataCenter, p.vcdClient.StorageProfileRef, p.cfg.PersistentDisk, p.cfg.VMachineName)
+		if err != nil {
+			log.Errorf("VMProcessor.Create.ensurePersistentDisk error: %v", err)
+			return nil, err
+		}
+
+		err = attachPersistentDisk(virtualMachine, disk)
+		if err != nil {
+			log.Errorf("VMProcessor.Create.attachPersistentDisk error: %v", err)
+			return nil, err
+		}
+	}
+
 	// set custom configs if it's not empty
-	if customCfg != nil {
+	switch {
+	case customCfg == nil:
+	case p.cfg.UserDataMode == UserDataModeOVFProperties:
+		var cloudInit cloudInitConfig
+
+		cloudInit, err = p.cloudInitConfig(customCfg)
+		if err != nil {
+			return nil, fmt.Errorf("VMProcessor.Create.cloudInitConfig error: %w", err)
+		}
+
+		err = applyOVFProperties(virtualMachine, cloudInit)
+		if err != nil {
+			return nil, fmt.Errorf("VMProcessor.Create.applyOVFProperties error: %w", err)
+		}
+	case p.cfg.UserDataMode == UserDataModeNoCloudISO:
+		var cloudInit cloudInitConfig
+
+		cloudInit, err = p.cloudInitConfig(customCfg)
+		if err != nil {
+			return nil, fmt.Errorf("VMProcessor.Create.cloudInitConfig error: %w", err)
+		}
+
+		// seed ISO must be inserted before the first power on, cloud-init reads it once
+		err = attachNoCloudMedia(p.vcdClient, p.cfg.Catalog, virtualMachine, cloudInit)
+		if err != nil {
+			return nil, fmt.Errorf("VMProcessor.Create.attachNoCloudMedia error: %w", err)
+		}
+	default:
 		var guestSection types.GuestCustomizationSection
 
 		guestSection, err = p.prepareCustomSectionForVM(*virtualMachine.VM.GuestCustomizationSection, customCfg)
@@ -409,27 +488,9 @@ func (p *VMProcessor) Remove() error {
 	}
 
 	// unmount disks
-	disksSettings := virtualMachine.VM.VmSpecSection.DiskSection.DiskSettings
-	for _, diskSpec := range disksSettings {
-		if diskSpec.UnitNumber == 0 {
-			log.Infof("VMProcessor.Remove.DeleteInternalDisk ignore OS disk with id %s", diskSpec.DiskId)
-			continue
-		}
-		log.Infof("VMProcessor.Remove.DeleteInternalDisk with id %s, name: %s", diskSpec.DiskId, diskSpec.Disk.Name)
-		task, errTask := virtualMachine.DetachDisk(&types.DiskAttachOrDetachParams{
-			Disk: &types.Reference{
-				HREF: diskSpec.Disk.HREF,
-			},
-		})
-		if errTask != nil {
-			log.Errorf("VMProcessor.Remove.DeleteInternalDisk error: %v", errTask)
-			return errTask
-		}
-
-		if err = task.WaitTaskCompletion(); err != nil {
-			log.Errorf("VMProcessor.Remove.DeleteInternalDisk error: %v", err)
-			return err
-		}
+	if err := detachIndependentDisks(p.vcdClient.VirtualDataCenter, virtualMachine, p.cfg.PersistentDisk.Name, p.cfg.DeletePersistentDisk); err != nil {
+		log.Errorf("VMProcessor.Remove.detachIndependentDisks error: %v", err)
+		return err
 	}
 
 	log.Infof("VMProcessor.Remove.DeleteAsync deleting VM %s in app: %s", p.cfg.VMachineName, p.cfg.VAppName)
@@ -445,6 +506,8 @@ func (p *VMProcessor) Remove() error {
 		return err
 	}
 
+	p.removeNoCloudMedia()
+
 	return nil
 }
 
@@ -504,27 +567,9 @@ func (p *VMProcessor) Kill() error {
 	}
 
 	// unmount disks
-	disksSettings := virtualMachine.VM.VmSpecSection.DiskSection.DiskSettings
-	for _, diskSpec := range disksSettings {
-		if diskSpec.UnitNumber == 0 {
-			log.Infof("VMProcessor.Remove.DeleteInternalDisk ignore OS disk with id %s", diskSpec.DiskId)
-			continue
-		}
-		log.Infof("VMProcessor.Remove.DeleteInternalDisk with id %s, name: %s", diskSpec.DiskId, diskSpec.Disk.Name)
-		task, errTask := virtualMachine.DetachDisk(&types.DiskAttachOrDetachParams{
-			Disk: &types.Reference{
-				HREF: diskSpec.Disk.HREF,
-			},
-		})
-		if errTask != nil {
-			log.Errorf("VMProcessor.Remove.DeleteInternalDisk error: %v", errTask)
-			return errTask
-		}
-
-		if err = task.WaitTaskCompletion(); err != nil {
-			log.Errorf("VMProcessor.Remove.DeleteInternalDisk error: %v", err)
-			return err
-		}
+	if err := detachIndependentDisks(p.vcdClient.VirtualDataCenter, virtualMachine, p.cfg.PersistentDisk.Name, p.cfg.DeletePersistentDisk); err != nil {
+		log.Errorf("VMProcessor.Kill.detachIndependentDisks error: %v", err)
+		return err
 	}
 
 	err = virtualMachine.Delete()
@@ -641,21 +686,86 @@ func (p *VMProcessor) Start() error {
 	return nil
 }
 
+// Resize applies CPU, memory and OS disk size of the config to the machine VM
+func (p *VMProcessor) Resize() error {
+	log.Infof("VMProcessor.Resize running with config: %+v", p.cfg)
+
+	vApp, err := p.vcdClient.VirtualDataCenter.GetVAppById(p.cfg.VAppID, true)
+	if err != nil {
+		log.Errorf("VMProcessor.Resize.GetVAppById error: %v", err)
+		return err
+	}
+
+	virtualMachine, err := vApp.GetVMById(p.cfg.VMachineID, true)
+	if err != nil {
+		log.Errorf("VMProcessor.Resize.GetVMById error: %v", err)
+		return err
+	}
+
+	if err := resizeVM(p.vcdClient, virtualMachine, p.cfg); err != nil {
+		log.Errorf("VMProcessor.Resize.resizeVM error: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// FinishCustomization ejects and deletes NoCloud seed ISO after the first boot of the machine
+func (p *VMProcessor) FinishCustomization() error {
+	if p.cfg.UserDataMode != UserDataModeNoCloudISO {
+		return nil
+	}
+
+	vApp, err := p.vcdClient.VirtualDataCenter.GetVAppByName(p.cfg.VAppName, true)
+	if err != nil {
+		log.Errorf("VMProcessor.FinishCustomization.GetVAppByName error: %v", err)
+		return err
+	}
+
+	virtualMachine, err := vApp.GetVMByName(p.cfg.VMachineName, true)
+	if err != nil {
+		log.Errorf("VMProcessor.FinishCustomization.GetVMByName error: %v", err)
+		return err
+	}
+
+	if err := ejectNoCloudMedia(p.vcdClient, p.cfg.Catalog, virtualMachine); err != nil {
+		log.Errorf("VMProcessor.FinishCustomization.ejectNoCloudMedia error: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// removeNoCloudMedia deletes NoCloud seed ISO left in the catalog when the VM is deleted
+func (p *VMProcessor) removeNoCloudMedia() {
+	if p.cfg.UserDataMode != UserDataModeNoCloudISO {
+		return
+	}
+
+	if err := removeNoCloudMedia(p.vcdClient, p.cfg.Catalog, p.cfg.VMachineName); err != nil {
+		log.Errorf("VMProcessor.removeNoCloudMedia error: %v", err)
+	}
+}
+
 func (p *VMProcessor) vmPostSettings(vm *govcd.VM) error {
 	log.Infof("VMProcessor.vmPostSettings running with custom config: %+v", p.cfg)
 
-	var numCPUsPtr *int
+	// hot add is enabled before the spec update, so later resize doesn't need power off
+	if err := applyHotAdd(vm, p.cfg); err != nil {
+		return fmt.Errorf("VMProcessor.vmPostSettings.applyHotAdd error: %w", err)
+	}
 
 	// config VM
-	cpuCount := p.cfg.CPUCount
-	numCPUsPtr = &cpuCount
-
 	vmSpecs := *vm.VM.VmSpecSection
 
-	vmSpecs.NumCpus = numCPUsPtr
-	vmSpecs.NumCoresPerSocket = numCPUsPtr
-	vmSpecs.MemoryResourceMb.Configured = p.cfg.MemorySize
-	vmSpecs.DiskSection.DiskSettings[0].SizeMb = p.cfg.DiskSize
+	if err := applySizing(&vmSpecs, p.cfg, p.vcdClient.SizingPolicy); err != nil {
+		return fmt.Errorf("VMProcessor.vmPostSettings.applySizing error: %w", err)
+	}
+
+	// data disks are added in the same reconfiguration before VM is powered on
+	if err := appendDataDisks(p.vcdClient.VirtualDataCenter, vmSpecs.DiskSection, p.cfg.DataDisks); err != nil {
+		return fmt.Errorf("VMProcessor.vmPostSettings.appendDataDisks error: %w", err)
+	}
 
 	_, err := vm.UpdateVmSpecSection(&vmSpecs, vm.VM.Description)
 	if err != nil {
@@ -696,6 +806,28 @@ func (p *VMProcessor) GetState() (state.State, error) {
 	return state.None, nil
 }
 
+// cloudInitConfig returns user data of custom script config for cloud-init based user data modes
+func (p *VMProcessor) cloudInitConfig(customCfg interface{}) (cloudInitConfig, error) {
+	cfg, ok := customCfg.(CustomScriptConfigVMProcessor)
+	if !ok {
+		return cloudInitConfig{}, fmt.Errorf("VMProcessor.cloudInitConfig invalid config type: %T", customCfg)
+	}
+
+	return cloudInitConfig{
+		Hostname:            cfg.MachineName,
+		SSHKey:              cfg.SSHKey,
+		AuthorizedKeys:      cfg.AuthorizedKeys,
+		HostPrivateKey:      cfg.HostPrivateKey,
+		HostPublicKey:       cfg.HostPublicKey,
+		SSHUser:             cfg.SSHUser,
+		UserData:            cfg.UserData,
+		InitData:            cfg.InitData,
+		Rke2:                cfg.Rke2,
+		DisablePasswordAuth: p.cfg.Bootstrap.DisablePasswordAuth,
+		DisableRootLogin:    p.cfg.Bootstrap.DisableRootLogin,
+	}, nil
+}
+
 func (p *VMProcessor) prepareCustomSectionForVM(
 	vmScript types.GuestCustomizationSection,
 	customCfg interface{},
@@ -718,9 +850,16 @@ func (p *VMProcessor) prepareCustomSectionForVM(
 
 	section.AdminPasswordEnabled = &cfg.RootAuth
 
-	scriptSh = cfg.InitData + "\n"
-	// append ssh user to script
-	scriptSh += "\nuseradd -m -d /home/" + cfg.SSHUser + " -s /bin/bash " + cfg.SSHUser + "\nmkdir -p /home/" + cfg.SSHUser + "/.ssh\nchmod 700 /home/" + cfg.SSHUser + "/.ssh\ntouch /home/" + cfg.SSHUser + "/.ssh/authorized_keys\nchmod 600 /home/" + cfg.SSHUser + "/.ssh/authorized_keys\necho \"" + strings.TrimSpace(cfg.SSHKey) + "\" > /home/" + cfg.SSHUser + "/.ssh/authorized_keys\necho \"" + cfg.SSHUser + "     ALL=(ALL) NOPASSWD:ALL\" >>  /etc/sudoers\nchown -R " + cfg.SSHUser + ". -R /home/" + cfg.SSHUser + "\n"
+	bootstrap, err := buildBootstrapScript(cfg.SSHUser, authorizedKeys(cfg.SSHKey, cfg.AuthorizedKeys), p.cfg.Bootstrap)
+	if err != nil {
+		return types.GuestCustomizationSection{}, fmt.Errorf("VMProcessor.prepareCustomSectionForVM.buildBootstrapScript error: %w", err)
+	}
+
+	scriptSh = cfg.InitData + "\n" + bootstrap
+
+	if cfg.HostPrivateKey != "" {
+		scriptSh += buildHostKeyScript(cfg.HostPrivateKey, cfg.HostPublicKey)
+	}
 
 	if cfg.Rke2 {
 		// if rke2
@@ -750,6 +889,11 @@ func (p *VMProcessor) prepareCustomSectionForVM(
 	return section, nil
 }
 
+// Cleanup removes VM of the machine after Create failed in the driver
+func (p *VMProcessor) Cleanup() error {
+	return p.cleanState()
+}
+
 func (p *VMProcessor) cleanState() error {
 	log.Infof("VMProcessor.cleanState running with config: %+v", p.cfg)
 
@@ -799,6 +943,12 @@ func (p *VMProcessor) cleanState() error {
 		}
 	}
 
+	// persistent disk is kept for the next create
+	if err := detachIndependentDisks(p.vcdClient.VirtualDataCenter, virtualMachine, p.cfg.PersistentDisk.Name, false); err != nil {
+		log.Errorf("VMProcessor.cleanState.detachIndependentDisks error: %v", err)
+		return err
+	}
+
 	task, err := virtualMachine.DeleteAsync()
 	if err != nil {
 		log.Errorf("VMProcessor.DeleteAsync error: %v", err)
@@ -810,6 +960,8 @@ func (p *VMProcessor) cleanState() error {
 		return err
 	}
 
+	p.removeNoCloudMedia()
+
 	log.Infof("VMProcessor.cleanState %s...", p.cfg.VMachineName)
 
 	return nil
@@ -1,12 +1,15 @@
 package vmwarevcloud
 
 import (
+	"github.com/DimKush/docker-driver-vcd/client"
+	"github.com/DimKush/docker-driver-vcd/processor"
 	"github.com/vmware/go-vcloud-director/v2/types/v56"
 )
 
 const (
 	defaultCatalog                 = "Public Catalog"
 	defaultCatalogItem             = "Ubuntu Server 12.04 LTS (amd64 20150127)"
+	defaultCatalogItemLatest       = client.CatalogItemLatestCreated
 	defaultCpus                    = 2
 	defaultMemory                  = 2048
 	defaultDisk                    = 20480
@@ -17,6 +20,21 @@ const (
 	defaultSSHUser                 = "docker"
 	defaultAdapterType             = ""
 	defaultIPAddressAllocationMode = types.IPAllocationModeDHCP
+	defaultPrimaryNIC              = 0
+	defaultIPWaitTimeout           = 600
+	defaultReadyTimeout            = 900
+	defaultUserDataMode            = processor.UserDataModeCustomization
+	defaultTemplateMode            = templateModeNone
+	defaultBootstrapDistro         = processor.BootstrapDistroAuto
 	defaultVAppName                = "docker-machine-default"
 	defaultRootAuth                = false
+	defaultProcessorMode           = processorModeVM
+	defaultConfigFileName          = "vcd-profiles.yml"
+	defaultSessionTTL              = 20
+	sessionCacheDirName            = "vcd-sessions"
+)
+
+const (
+	processorModeVM   = "vm"
+	processorModeVApp = "vapp"
 )
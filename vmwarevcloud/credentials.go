@@ -0,0 +1,200 @@
+package vmwarevcloud
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/DimKush/docker-driver-vcd/client"
+	"github.com/DimKush/docker-driver-vcd/credentials"
+	log "github.com/docker/machine/libmachine/log"
+)
+
+// apiTokenFileName is a file of the machine directory with the inline vcd-api-token
+const apiTokenFileName = "vcd-api-token"
+
+// passwordKeyringService is the OS keyring service of inline vcd-password, the account is user@org
+const passwordKeyringService = "docker-machine-driver-vcd"
+
+// storeInlineSecrets moves inline secrets of the flags out of machine config, it keeps only references.
+// Inline vcd-password is stored in OS keyring, create fails if the keyring isn't available
+func (d *Driver) storeInlineSecrets() error {
+	if d.APIToken != "" {
+		tokenFile, err := d.storeSecretFile(apiTokenFileName, d.APIToken)
+		if err != nil {
+			return err
+		}
+
+		d.TokenFile = tokenFile
+		d.APIToken = ""
+	}
+
+	if d.UserPassword != "" {
+		passwordSource := credentials.KindKeyring + ":" + passwordKeyringService
+
+		source, err := credentials.Parse(passwordSource)
+		if err != nil {
+			return err
+		}
+
+		if err := source.Store(d.credentialsLookup(), d.UserPassword); err != nil {
+			return fmt.Errorf("inline vcd-password can't be stored in OS keyring (%v), "+
+				"use vcd-password-source env:, helper: or keyring: instead", err)
+		}
+
+		d.PasswordSource = passwordSource
+		d.UserPassword = ""
+	}
+
+	return nil
+}
+
+// storeSecretFile writes secret to a file of the machine directory readable only by the owner
+func (d *Driver) storeSecretFile(name, secret string) (string, error) {
+	path := d.ResolveStorePath(name)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", fmt.Errorf("storeSecretFile.MkdirAll error: %w", err)
+	}
+
+	if err := os.WriteFile(path, []byte(secret+"\n"), 0600); err != nil {
+		return "", fmt.Errorf("storeSecretFile.WriteFile error: %w", err)
+	}
+
+	return path, nil
+}
+
+// resolvePassword returns VCD password. Machines created before vcd-password-source
+// keep an inline password in config until it's migrated with vcd-tool migrate-credentials
+func (d *Driver) resolvePassword() (string, error) {
+	if d.usesToken() {
+		return "", nil
+	}
+
+	if d.PasswordSource == "" {
+		if d.UserPassword != "" {
+			log.Warnf("machine %s keeps vcd password in plain text config, migrate it with: vcd-tool migrate-credentials %s", d.MachineName, d.MachineName)
+		}
+
+		return d.UserPassword, nil
+	}
+
+	password, err := credentials.Resolve(d.PasswordSource, d.credentialsLookup())
+	if err != nil {
+		return "", fmt.Errorf("unable to resolve vcd password from %s: %w", d.PasswordSource, err)
+	}
+
+	return password, nil
+}
+
+// credentialsLookup identifies VCD password in credential helpers and keyrings
+func (d *Driver) credentialsLookup() credentials.Lookup {
+	return credentials.Lookup{
+		ServerURL: d.Href,
+		Account:   d.UserName + "@" + d.Org,
+	}
+}
+
+// validateProxy checks vcd-proxy-url. Proxy password is never stored inline,
+// it's kept in vcd-proxy-password-source like VCD password
+func (d *Driver) validateProxy() error {
+	if d.ProxyURL == "" {
+		if d.ProxyPasswordSource != "" {
+			return fmt.Errorf("vcd-proxy-password-source requires vcd-proxy-url")
+		}
+
+		return nil
+	}
+
+	proxyURL, err := url.Parse(d.ProxyURL)
+	if err != nil {
+		return fmt.Errorf("unable to parse vcd-proxy-url: %w", err)
+	}
+
+	if err := client.ValidateProxyURL(proxyURL); err != nil {
+		return err
+	}
+
+	if _, hasPassword := proxyURL.User.Password(); hasPassword {
+		return fmt.Errorf("vcd-proxy-url must not contain password, use vcd-proxy-password-source")
+	}
+
+	if d.ProxyPasswordSource != "" {
+		if proxyURL.User.Username() == "" {
+			return fmt.Errorf("vcd-proxy-password-source requires user in vcd-proxy-url")
+		}
+
+		if _, err := credentials.Parse(d.ProxyPasswordSource); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// resolveProxyURL returns proxy URL with the password from vcd-proxy-password-source
+func (d *Driver) resolveProxyURL() (*url.URL, error) {
+	if d.ProxyURL == "" {
+		return nil, nil
+	}
+
+	proxyURL, err := url.Parse(d.ProxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse vcd-proxy-url: %w", err)
+	}
+
+	if d.ProxyPasswordSource == "" {
+		return proxyURL, nil
+	}
+
+	userName := proxyURL.User.Username()
+
+	serverURL := *proxyURL
+	serverURL.User = nil
+
+	password, err := credentials.Resolve(d.ProxyPasswordSource, credentials.Lookup{
+		ServerURL: serverURL.String(),
+		Account:   userName,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to resolve proxy password from %s: %w", d.ProxyPasswordSource, err)
+	}
+
+	proxyURL.User = url.UserPassword(userName, password)
+
+	return proxyURL, nil
+}
+
+// MigrateCredentials moves inline password of the machine to passwordSource
+// and keeps only the reference in machine config
+func (d *Driver) MigrateCredentials(passwordSource string) error {
+	if d.usesToken() || d.UserPassword == "" {
+		return fmt.Errorf("machine %s has no inline vcd password", d.MachineName)
+	}
+
+	source, err := credentials.Parse(passwordSource)
+	if err != nil {
+		return err
+	}
+
+	// env variables can't be written, the password must be exported before migration
+	if errStore := source.Store(d.credentialsLookup(), d.UserPassword); errStore != nil {
+		log.Infof("MigrateCredentials password of %s can't be stored in %s: %v", d.MachineName, passwordSource, errStore)
+	}
+
+	// the inline password is dropped only when the source returns exactly the same password
+	password, err := source.Resolve(d.credentialsLookup())
+	if err != nil {
+		return fmt.Errorf("unable to read migrated password of %s from %s: %w", d.MachineName, passwordSource, err)
+	}
+
+	if password != d.UserPassword {
+		return fmt.Errorf("password of %s in %s differs from the inline password, machine config is left unchanged", d.MachineName, passwordSource)
+	}
+
+	d.PasswordSource = passwordSource
+	d.UserPassword = ""
+
+	return nil
+}
@@ -5,22 +5,30 @@ import (
 	"net"
 	"net/url"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/DimKush/docker-driver-vcd/client"
+	"github.com/DimKush/docker-driver-vcd/credentials"
 	processor "github.com/DimKush/docker-driver-vcd/processor"
 	"github.com/docker/machine/libmachine/drivers"
 	log "github.com/docker/machine/libmachine/log"
 	"github.com/docker/machine/libmachine/mcnflag"
 	"github.com/docker/machine/libmachine/ssh"
 	"github.com/docker/machine/libmachine/state"
+	"github.com/vmware/go-vcloud-director/v2/govcd"
+	"github.com/vmware/go-vcloud-director/v2/types/v56"
 )
 
 type Driver struct {
 	*drivers.BaseDriver
 	UserName                string
 	UserPassword            string
+	PasswordSource          string
+	APIToken                string
+	TokenFile               string
 	VDC                     string
 	OrgVDCNet               string
 	EdgeGateway             string
@@ -29,24 +37,69 @@ type Driver struct {
 	PrivateIP               string
 	Catalog                 string
 	CatalogItem             string
+	CatalogItemID           string
+	CatalogItemMatch        string
+	CatalogItemLatest       string
+	TemplateVM              string
+	TemplateSource          string
 	StorProfile             string
 	UserData                string
 	InitData                string
+	UserDataMode            string
+	SSHKeySourcePath        string
+	HostKeyFingerprint      string
+	SSHAuthorizedKeys       []string
+	BootstrapDistro         string
+	SSHDisablePasswordAuth  bool
+	SSHDisableRootLogin     bool
+	TemplateMode            string
+	TemplateVars            []string
 	AdapterType             string
 	IPAddressAllocationMode string
+	StaticIPAddress         string
+	Networks                []string
+	PrimaryNIC              int
+	IPWaitTimeout           int
+	ReadyTimeout            int
+	SkipReadyWait           bool
+	WaitSSH                 bool
 	DockerPort              int
 	CPUCount                int
+	CoresPerSocket          int
+	CPUReservation          int
+	CPULimit                int
+	CPUShares               string
+	CPUHotAdd               bool
 	MemorySize              int
+	MemoryReservation       int
+	MemoryLimit             int
+	MemoryShares            string
+	MemoryHotAdd            bool
+	SizingPolicy            string
+	PlacementPolicy         string
 	DiskSize                int
+	DataDisks               []string
+	PersistentDisk          string
+	DeletePersistentDisk    bool
 	VAppID                  string
 	Href                    string
 	Url                     *url.URL
 	Org                     string
 	Insecure                bool
+	CACert                  string
+	TLSFingerprint          string
+	ProxyURL                string
+	ProxyPasswordSource     string
+	NoProxy                 string
+	NoSessionCache          bool
+	SessionTTL              int
 	Rke2                    bool
 	VAppName                string
 	VMachineID              string
 	RootAuth                bool
+	ProcessorMode           string
+	Profile                 string
+	ConfigFile              string
 }
 
 func NewDriver(hostName, storePath string) drivers.Driver {
@@ -54,6 +107,7 @@ func NewDriver(hostName, storePath string) drivers.Driver {
 		VAppName:                defaultVAppName,
 		Catalog:                 defaultCatalog,
 		CatalogItem:             defaultCatalogItem,
+		CatalogItemLatest:       defaultCatalogItemLatest,
 		CPUCount:                defaultCpus,
 		MemorySize:              defaultMemory,
 		DiskSize:                defaultDisk,
@@ -62,6 +116,12 @@ func NewDriver(hostName, storePath string) drivers.Driver {
 		Rke2:                    defaultRke2,
 		AdapterType:             defaultAdapterType,
 		RootAuth:                defaultRootAuth,
+		SessionTTL:              defaultSessionTTL,
+		IPWaitTimeout:           defaultIPWaitTimeout,
+		ReadyTimeout:            defaultReadyTimeout,
+		UserDataMode:            defaultUserDataMode,
+		BootstrapDistro:         defaultBootstrapDistro,
+		TemplateMode:            defaultTemplateMode,
 		IPAddressAllocationMode: defaultIPAddressAllocationMode,
 		BaseDriver: &drivers.BaseDriver{
 			SSHPort:     defaultSSHPort,
@@ -87,6 +147,21 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			Name:   "vcd-password",
 			Usage:  "vCloud Director password",
 		},
+		mcnflag.StringFlag{
+			EnvVar: "VCD_PASSWORD_SOURCE",
+			Name:   "vcd-password-source",
+			Usage:  "vCloud Director password reference instead of vcd-password: env:NAME, file:/path, helper:NAME (docker-credential-NAME) or keyring:SERVICE",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "VCD_API_TOKEN",
+			Name:   "vcd-api-token",
+			Usage:  "vCloud Director API token (used instead of vcd-username and vcd-password)",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "VCD_TOKEN_FILE",
+			Name:   "vcd-token-file",
+			Usage:  "Path to file with vCloud Director API token or service account token JSON (used instead of vcd-username and vcd-password)",
+		},
 		mcnflag.StringFlag{
 			EnvVar: "VCD_VDC",
 			Name:   "vcd-vdc",
@@ -119,6 +194,44 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			Usage:  "vCloud Director IP Address Allocation Mode like DHCP",
 			Value:  defaultIPAddressAllocationMode,
 		},
+		mcnflag.StringFlag{
+			EnvVar: "VCD_IP_ADDRESS",
+			Name:   "vcd-ip-address",
+			Usage:  "vCloud Director VM IP address for MANUAL (or POOL) allocation mode",
+		},
+		mcnflag.StringSliceFlag{
+			EnvVar: "VCD_NETWORK",
+			Name:   "vcd-network",
+			Usage:  "Additional NIC name[:adapter[:allocation[:ip]]], repeat the flag for several NICs",
+		},
+		mcnflag.IntFlag{
+			EnvVar: "VCD_PRIMARY_NIC",
+			Name:   "vcd-primary-nic",
+			Usage:  "Index of NIC whose IP address is used by docker-machine (0 is vcd-orgvdcnetwork, 1.. are vcd-network NICs)",
+			Value:  defaultPrimaryNIC,
+		},
+		mcnflag.IntFlag{
+			EnvVar: "VCD_IP_WAIT_TIMEOUT",
+			Name:   "vcd-ip-wait-timeout",
+			Usage:  "Seconds to wait for VM IP address after power on, 0 waits without limit (default 600)",
+			Value:  defaultIPWaitTimeout,
+		},
+		mcnflag.IntFlag{
+			EnvVar: "VCD_READY_TIMEOUT",
+			Name:   "vcd-ready-timeout",
+			Usage:  "Seconds to wait for guest tools and guest customization after the VM got its address, 0 waits without limit (default 900)",
+			Value:  defaultReadyTimeout,
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "VCD_SKIP_READY_WAIT",
+			Name:   "vcd-skip-ready-wait",
+			Usage:  "Don't wait for guest tools and guest customization before create returns",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "VCD_WAIT_SSH",
+			Name:   "vcd-wait-ssh",
+			Usage:  "Wait until SSH port of the VM accepts connections before create returns",
+		},
 		mcnflag.StringFlag{
 			EnvVar: "VCD_EDGEGATEWAY",
 			Name:   "vcd-edgegateway",
@@ -141,6 +254,32 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			Usage:  "vCloud Director Catalog Item (default is Ubuntu Precise)",
 			Value:  defaultCatalogItem,
 		},
+		mcnflag.StringFlag{
+			EnvVar: "VCD_CATALOGITEM_ID",
+			Name:   "vcd-catalogitem-id",
+			Usage:  "vCloud Director Catalog Item ID, takes precedence over vcd-catalogitem and vcd-catalogitem-match",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "VCD_CATALOGITEM_MATCH",
+			Name:   "vcd-catalogitem-match",
+			Usage:  "Glob or regex:<regular expression> of vCloud Director Catalog Item names, the latest matching item is used instead of vcd-catalogitem",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "VCD_CATALOGITEM_LATEST",
+			Name:   "vcd-catalogitem-latest",
+			Usage:  "Latest vcd-catalogitem-match item by creation date (created) or by version numbers in the name (version)",
+			Value:  defaultCatalogItemLatest,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "VCD_TEMPLATE_VM",
+			Name:   "vcd-template-vm",
+			Usage:  "VM name inside multi-VM vApp template of the catalog item (default is the first VM)",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "VCD_TEMPLATE_SOURCE",
+			Name:   "vcd-template-source",
+			Usage:  "Local OVA or OVF file uploaded to vcd-catalog as vcd-catalogitem if the item is missing",
+		},
 		mcnflag.StringFlag{
 			EnvVar: "VCD_STORPROFILE",
 			Name:   "vcd-storprofile",
@@ -156,6 +295,42 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			Name:   "vcd-insecure",
 			Usage:  "vCloud Director allow non secure connections",
 		},
+		mcnflag.StringFlag{
+			EnvVar: "VCD_CA_CERT",
+			Name:   "vcd-ca-cert",
+			Usage:  "PEM bundle with CA certificates to verify vCloud Director API certificate",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "VCD_TLS_FINGERPRINT",
+			Name:   "vcd-tls-fingerprint",
+			Usage:  "SHA-256 fingerprint of vCloud Director API certificate (or its CA) to pin",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "VCD_PROXY_URL",
+			Name:   "vcd-proxy-url",
+			Usage:  "Proxy for vCloud Director API: http://[user@]host:port or socks5://[user@]host:port",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "VCD_PROXY_PASSWORD_SOURCE",
+			Name:   "vcd-proxy-password-source",
+			Usage:  "Proxy password reference: env:NAME, file:/path, helper:NAME (docker-credential-NAME) or keyring:SERVICE",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "VCD_NO_PROXY",
+			Name:   "vcd-no-proxy",
+			Usage:  "Comma separated hosts, domains and CIDRs reached without vcd-proxy-url",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "VCD_NO_SESSION_CACHE",
+			Name:   "vcd-no-session-cache",
+			Usage:  "Don't share vCloud Director sessions between driver calls, log in on every call",
+		},
+		mcnflag.IntFlag{
+			EnvVar: "VCD_SESSION_TTL",
+			Name:   "vcd-session-ttl",
+			Usage:  "Lifetime of cached vCloud Director session in minutes (default 20)",
+			Value:  defaultSessionTTL,
+		},
 		mcnflag.BoolFlag{
 			EnvVar: "VCD_RKE2",
 			Name:   "vcd-rke2",
@@ -167,18 +342,88 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			Usage:  "vCloud Director VM Cpu Count (default 1)",
 			Value:  defaultCpus,
 		},
+		mcnflag.IntFlag{
+			EnvVar: "VCD_CORES_PER_SOCKET",
+			Name:   "vcd-cores-per-socket",
+			Usage:  "vCloud Director VM cores per socket, must divide vcd-cpu-count (default is all cores in one socket)",
+		},
+		mcnflag.IntFlag{
+			EnvVar: "VCD_CPU_RESERVATION",
+			Name:   "vcd-cpu-reservation",
+			Usage:  "vCloud Director VM CPU reservation in MHz",
+		},
+		mcnflag.IntFlag{
+			EnvVar: "VCD_CPU_LIMIT",
+			Name:   "vcd-cpu-limit",
+			Usage:  "vCloud Director VM CPU limit in MHz, -1 is unlimited",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "VCD_CPU_SHARES",
+			Name:   "vcd-cpu-shares",
+			Usage:  "vCloud Director VM CPU shares: LOW, NORMAL, HIGH or a number of custom shares",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "VCD_CPU_HOT_ADD",
+			Name:   "vcd-cpu-hot-add",
+			Usage:  "Enable CPU hot add for vCloud Director VM",
+		},
 		mcnflag.IntFlag{
 			EnvVar: "VCD_MEMORY_SIZE",
 			Name:   "vcd-memory-size",
 			Usage:  "vCloud Director VM Memory Size in MB (default 2048)",
 			Value:  defaultMemory,
 		},
+		mcnflag.IntFlag{
+			EnvVar: "VCD_MEMORY_RESERVATION",
+			Name:   "vcd-memory-reservation",
+			Usage:  "vCloud Director VM memory reservation in MB",
+		},
+		mcnflag.IntFlag{
+			EnvVar: "VCD_MEMORY_LIMIT",
+			Name:   "vcd-memory-limit",
+			Usage:  "vCloud Director VM memory limit in MB, -1 is unlimited",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "VCD_MEMORY_SHARES",
+			Name:   "vcd-memory-shares",
+			Usage:  "vCloud Director VM memory shares: LOW, NORMAL, HIGH or a number of custom shares",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "VCD_MEMORY_HOT_ADD",
+			Name:   "vcd-memory-hot-add",
+			Usage:  "Enable memory hot add for vCloud Director VM",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "VCD_SIZING_POLICY",
+			Name:   "vcd-sizing-policy",
+			Usage:  "vCloud Director VM sizing policy name assigned to the VDC, CPU and memory of the policy take precedence over vcd-cpu-count and vcd-memory-size",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "VCD_PLACEMENT_POLICY",
+			Name:   "vcd-placement-policy",
+			Usage:  "vCloud Director VM placement policy name assigned to the VDC",
+		},
 		mcnflag.IntFlag{
 			EnvVar: "VCD_DISK_SIZE",
 			Name:   "vcd-disk-size",
 			Usage:  "vCloud Director VM Disk Size in MB (default 20480)",
 			Value:  defaultDisk,
 		},
+		mcnflag.StringSliceFlag{
+			EnvVar: "VCD_DATA_DISK",
+			Name:   "vcd-data-disk",
+			Usage:  "Additional disk size_mb[:storage_profile[:bus_type]], repeat the flag for several disks. Bus types: ide, buslogic, lsilogic, lsilogicsas, paravirtual, sata, nvme",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "VCD_PERSISTENT_DISK",
+			Name:   "vcd-persistent-disk",
+			Usage:  "Named independent disk name:size_mb which is kept on machine removal and reattached on next create with the same name",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "VCD_DELETE_PERSISTENT_DISK",
+			Name:   "vcd-delete-persistent-disk",
+			Usage:  "Delete vcd-persistent-disk when the machine is removed",
+		},
 		mcnflag.IntFlag{
 			EnvVar: "VCD_SSH_PORT",
 			Name:   "vcd-ssh-port",
@@ -197,6 +442,32 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			Usage:  "vCloud Director SSH user",
 			Value:  defaultSSHUser,
 		},
+		mcnflag.StringFlag{
+			EnvVar: "VCD_SSH_KEY_PATH",
+			Name:   "vcd-ssh-key-path",
+			Usage:  "Existing private SSH key of the machine instead of a generated one, its .pub file must match if present",
+		},
+		mcnflag.StringSliceFlag{
+			EnvVar: "VCD_SSH_AUTHORIZED_KEY",
+			Name:   "vcd-ssh-authorized-key",
+			Usage:  "Additional public key (file or literal key) appended to authorized_keys of the SSH user, repeat the flag for several keys",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "VCD_BOOTSTRAP_DISTRO",
+			Name:   "vcd-bootstrap-distro",
+			Usage:  "Linux family of the SSH user bootstrap in customization mode: auto (default, by /etc/os-release), debian, rhel or alpine",
+			Value:  defaultBootstrapDistro,
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "VCD_SSH_DISABLE_PASSWORD_AUTH",
+			Name:   "vcd-ssh-disable-password-auth",
+			Usage:  "Disable SSH password authentication in the guest",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "VCD_SSH_DISABLE_ROOT_LOGIN",
+			Name:   "vcd-ssh-disable-root-login",
+			Usage:  "Disable SSH login of root in the guest",
+		},
 		mcnflag.StringFlag{
 			EnvVar: "VCD_USER_DATA",
 			Name:   "vcd-user-data",
@@ -209,6 +480,23 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			Usage:  "Cloud-init based User data before everything",
 			Value:  "",
 		},
+		mcnflag.StringFlag{
+			EnvVar: "VCD_USERDATA_MODE",
+			Name:   "vcd-userdata-mode",
+			Usage:  "User data delivery: customization (guest customization script), ovf-properties (cloud-init user-data and meta-data in VM ProductSection) or nocloud-iso (cloud-init NoCloud seed ISO uploaded to vcd-catalog and inserted into VM)",
+			Value:  defaultUserDataMode,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "VCD_TEMPLATE_MODE",
+			Name:   "vcd-template-mode",
+			Usage:  "Go text/template rendering of vcd-user-data and vcd-init-data: none (default), render (undefined vcd-template-var is empty) or strict (undefined vcd-template-var fails create)",
+			Value:  defaultTemplateMode,
+		},
+		mcnflag.StringSliceFlag{
+			EnvVar: "VCD_TEMPLATE_VAR",
+			Name:   "vcd-template-var",
+			Usage:  "Template variable key=value available as {{ .Vars.key }} in vcd-user-data and vcd-init-data, repeat the flag for several variables",
+		},
 		mcnflag.StringFlag{
 			EnvVar: "VCD_VAPP_NAME",
 			Name:   "vcd-vapp-name",
@@ -220,30 +508,145 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			Name:   "vcd-root-auth",
 			Usage:  "Create VM with root password in tty",
 		},
+		mcnflag.StringFlag{
+			EnvVar: "VCD_PROCESSOR_MODE",
+			Name:   "vcd-processor-mode",
+			Usage:  "vCloud Director processor mode: vm (VM inside vcd-vapp-name vApp) or vapp (own vApp per machine)",
+			Value:  defaultProcessorMode,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "VCD_PROFILE",
+			Name:   "vcd-profile",
+			Usage:  "Profile name from vcd-config-file, explicit flags override profile values",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "VCD_CONFIG_FILE",
+			Name:   "vcd-config-file",
+			Usage:  "YAML file with vCloud Director profiles (default is <machine storage path>/vcd-profiles.yml)",
+		},
 	}
 }
 
 func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
+	// profile values are applied first, explicit flags override them
+	flags, err := d.withProfile(flags)
+	if err != nil {
+		return err
+	}
 
 	d.UserName = flags.String("vcd-username")
 	d.UserPassword = flags.String("vcd-password")
+	d.PasswordSource = flags.String("vcd-password-source")
+	d.APIToken = flags.String("vcd-api-token")
+	d.TokenFile = flags.String("vcd-token-file")
 	d.VDC = flags.String("vcd-vdc")
 	d.Org = flags.String("vcd-org")
 	d.Href = flags.String("vcd-href")
 	d.Insecure = flags.Bool("vcd-insecure")
+	d.CACert = flags.String("vcd-ca-cert")
+	d.TLSFingerprint = flags.String("vcd-tls-fingerprint")
+	d.ProxyURL = flags.String("vcd-proxy-url")
+	d.ProxyPasswordSource = flags.String("vcd-proxy-password-source")
+	d.NoProxy = flags.String("vcd-no-proxy")
+	d.NoSessionCache = flags.Bool("vcd-no-session-cache")
+	d.SessionTTL = flags.Int("vcd-session-ttl")
 	d.Rke2 = flags.Bool("vcd-rke2")
 	d.PublicIP = flags.String("vcd-publicip")
 	d.StorProfile = flags.String("vcd-storprofile")
 	d.UserData = flags.String("vcd-user-data")
 	d.InitData = flags.String("vcd-init-data")
+	d.UserDataMode = flags.String("vcd-userdata-mode")
+	d.TemplateMode = flags.String("vcd-template-mode")
+	d.TemplateVars = flags.StringSlice("vcd-template-var")
 	d.AdapterType = flags.String("vcd-networkadaptertype")
 	d.IPAddressAllocationMode = flags.String("vcd-ipaddressallocationmode")
+	d.StaticIPAddress = flags.String("vcd-ip-address")
+	d.Networks = flags.StringSlice("vcd-network")
+	d.PrimaryNIC = flags.Int("vcd-primary-nic")
+	d.IPWaitTimeout = flags.Int("vcd-ip-wait-timeout")
+	d.ReadyTimeout = flags.Int("vcd-ready-timeout")
+	d.SkipReadyWait = flags.Bool("vcd-skip-ready-wait")
+	d.WaitSSH = flags.Bool("vcd-wait-ssh")
 	d.RootAuth = flags.Bool("vcd-root-auth")
+	d.ProcessorMode = flags.String("vcd-processor-mode")
+	if d.ProcessorMode == "" {
+		d.ProcessorMode = defaultProcessorMode
+	}
 	d.SetSwarmConfigFromFlags(flags)
 
+	switch d.UserDataMode {
+	case processor.UserDataModeCustomization, processor.UserDataModeOVFProperties, processor.UserDataModeNoCloudISO:
+	default:
+		return fmt.Errorf("invalid vcd-userdata-mode %q, expected %s, %s or %s", d.UserDataMode,
+			processor.UserDataModeCustomization, processor.UserDataModeOVFProperties, processor.UserDataModeNoCloudISO)
+	}
+
+	switch d.TemplateMode {
+	case templateModeNone, templateModeRender, templateModeStrict:
+	default:
+		return fmt.Errorf("invalid vcd-template-mode %q, expected %s, %s or %s", d.TemplateMode, templateModeNone, templateModeRender, templateModeStrict)
+	}
+
+	if _, err := parseTemplateVars(d.TemplateVars); err != nil {
+		return err
+	}
+
+	if d.APIToken != "" && d.TokenFile != "" {
+		return fmt.Errorf("please specify only one of options: -vcd-api-token or -vcd-token-file")
+	}
+
+	// password must not be stored when token is used
+	if d.usesToken() {
+		d.UserPassword = ""
+		d.PasswordSource = ""
+	}
+
+	// only the reference is stored, password is resolved at call time
+	if d.PasswordSource != "" {
+		if _, err := credentials.Parse(d.PasswordSource); err != nil {
+			return err
+		}
+
+		d.UserPassword = ""
+	}
+
 	// Check for required Params
-	if d.UserName == "" || d.UserPassword == "" || d.Href == "" || d.VDC == "" || d.Org == "" || d.StorProfile == "" {
-		return fmt.Errorf("please specify vclouddirector mandatory params using options: -vcd-username -vcd-password -vcd-vdc -vcd-href -vcd-org and -vcd-storprofile")
+	if err := d.validateMandatoryParams(); err != nil {
+		return err
+	}
+
+	if d.Insecure && (d.CACert != "" || d.TLSFingerprint != "") {
+		return fmt.Errorf("please specify either -vcd-insecure or -vcd-ca-cert/-vcd-tls-fingerprint")
+	}
+
+	if d.TLSFingerprint != "" {
+		if _, err := client.ParseTLSFingerprint(d.TLSFingerprint); err != nil {
+			return err
+		}
+	}
+
+	if err := d.validateStaticIPAddress(); err != nil {
+		return err
+	}
+
+	if err := d.validateNetworks(); err != nil {
+		return err
+	}
+
+	if err := d.validateProxy(); err != nil {
+		return err
+	}
+
+	if d.IPWaitTimeout < 0 {
+		return fmt.Errorf("invalid vcd-ip-wait-timeout %d, expected seconds or 0", d.IPWaitTimeout)
+	}
+
+	if d.ReadyTimeout < 0 {
+		return fmt.Errorf("invalid vcd-ready-timeout %d, expected seconds or 0", d.ReadyTimeout)
+	}
+
+	if d.ProcessorMode != processorModeVM && d.ProcessorMode != processorModeVApp {
+		return fmt.Errorf("unknown vcd-processor-mode %q, expected %s or %s", d.ProcessorMode, processorModeVM, processorModeVApp)
 	}
 
 	u, err := url.ParseRequestURI(d.Href)
@@ -270,16 +673,303 @@ func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
 
 	d.Catalog = flags.String("vcd-catalog")
 	d.CatalogItem = flags.String("vcd-catalogitem")
+	d.CatalogItemID = flags.String("vcd-catalogitem-id")
+	d.CatalogItemMatch = flags.String("vcd-catalogitem-match")
+	d.CatalogItemLatest = flags.String("vcd-catalogitem-latest")
+	d.TemplateVM = flags.String("vcd-template-vm")
+	d.TemplateSource = flags.String("vcd-template-source")
+
+	if d.TemplateSource != "" {
+		// uploaded item is named by vcd-catalogitem, its ID is unknown before upload
+		if d.CatalogItemID != "" || d.CatalogItemMatch != "" {
+			return fmt.Errorf("vcd-template-source can't be used with vcd-catalogitem-id or vcd-catalogitem-match")
+		}
+
+		if _, err := os.Stat(d.TemplateSource); err != nil {
+			return fmt.Errorf("invalid vcd-template-source: %w", err)
+		}
+	}
+
+	if d.CatalogItemMatch != "" {
+		if _, err := client.ParseCatalogItemMatch(d.CatalogItemMatch); err != nil {
+			return err
+		}
+	}
+
+	switch d.CatalogItemLatest {
+	case client.CatalogItemLatestCreated, client.CatalogItemLatestVersion:
+	default:
+		return fmt.Errorf("invalid vcd-catalogitem-latest %q, expected %s or %s", d.CatalogItemLatest, client.CatalogItemLatestCreated, client.CatalogItemLatestVersion)
+	}
 
 	d.DockerPort = flags.Int("vcd-docker-port")
 	d.SSHUser = flags.String("vcd-ssh-user")
+	d.SSHKeySourcePath = flags.String("vcd-ssh-key-path")
+	d.SSHAuthorizedKeys = flags.StringSlice("vcd-ssh-authorized-key")
+	d.BootstrapDistro = flags.String("vcd-bootstrap-distro")
+	d.SSHDisablePasswordAuth = flags.Bool("vcd-ssh-disable-password-auth")
+	d.SSHDisableRootLogin = flags.Bool("vcd-ssh-disable-root-login")
+
+	if err := processor.ValidateSSHUser(d.SSHUser); err != nil {
+		return err
+	}
+
+	if err := processor.ValidateBootstrapDistro(d.BootstrapDistro); err != nil {
+		return err
+	}
+
+	// keys are checked before create starts
+	if d.SSHKeySourcePath != "" {
+		if _, _, err := loadSSHKeyPair(d.SSHKeySourcePath); err != nil {
+			return err
+		}
+	}
+
+	if _, err := readAuthorizedKeys(d.SSHAuthorizedKeys); err != nil {
+		return err
+	}
+
 	d.SSHPort = flags.Int("vcd-ssh-port")
 	d.CPUCount = flags.Int("vcd-cpu-count")
 	d.MemorySize = flags.Int("vcd-memory-size")
 	d.DiskSize = flags.Int("vcd-disk-size")
+	d.CoresPerSocket = flags.Int("vcd-cores-per-socket")
+	d.CPUReservation = flags.Int("vcd-cpu-reservation")
+	d.CPULimit = flags.Int("vcd-cpu-limit")
+	d.CPUShares = flags.String("vcd-cpu-shares")
+	d.CPUHotAdd = flags.Bool("vcd-cpu-hot-add")
+	d.MemoryReservation = flags.Int("vcd-memory-reservation")
+	d.MemoryLimit = flags.Int("vcd-memory-limit")
+	d.MemoryShares = flags.String("vcd-memory-shares")
+	d.MemoryHotAdd = flags.Bool("vcd-memory-hot-add")
+	d.SizingPolicy = flags.String("vcd-sizing-policy")
+	d.PlacementPolicy = flags.String("vcd-placement-policy")
+
+	if err := d.validateSizing(); err != nil {
+		return err
+	}
+	d.DataDisks = flags.StringSlice("vcd-data-disk")
+
+	for _, spec := range d.DataDisks {
+		if _, err := processor.ParseDataDiskSpec(spec); err != nil {
+			return err
+		}
+	}
+
+	d.PersistentDisk = flags.String("vcd-persistent-disk")
+	d.DeletePersistentDisk = flags.Bool("vcd-delete-persistent-disk")
+
+	if d.PersistentDisk != "" {
+		if _, err := processor.ParsePersistentDiskSpec(d.PersistentDisk); err != nil {
+			return err
+		}
+
+		// VAppProcessor removes the whole vApp, named disks are supported only for VM in shared vApp
+		if d.ProcessorMode != processorModeVM {
+			return fmt.Errorf("vcd-persistent-disk requires %s vcd-processor-mode", processorModeVM)
+		}
+	}
 	d.VAppName = flags.String("vcd-vapp-name")
 	d.PrivateIP = d.PublicIP
 
+	// VAppProcessor creates vApp and VM with the same name as machine
+	if d.ProcessorMode == processorModeVApp {
+		d.VAppName = d.MachineName
+	}
+
+	return d.storeInlineSecrets()
+}
+
+// validateStaticIPAddress checks vcd-ip-address. Address on the network is validated in BuildInstance
+func (d *Driver) validateStaticIPAddress() error {
+	if d.StaticIPAddress == "" {
+		return nil
+	}
+
+	if net.ParseIP(d.StaticIPAddress) == nil {
+		return fmt.Errorf("invalid vcd-ip-address %q", d.StaticIPAddress)
+	}
+
+	switch d.IPAddressAllocationMode {
+	case types.IPAllocationModeManual, types.IPAllocationModePool:
+	case types.IPAllocationModeDHCP:
+		// DHCP is a default mode, explicit address means MANUAL allocation
+		log.Infof("vcd-ip-address %s is set, using %s IP address allocation mode", d.StaticIPAddress, types.IPAllocationModeManual)
+		d.IPAddressAllocationMode = types.IPAllocationModeManual
+	default:
+		return fmt.Errorf("vcd-ip-address requires %s or %s vcd-ipaddressallocationmode, got %s",
+			types.IPAllocationModeManual, types.IPAllocationModePool, d.IPAddressAllocationMode)
+	}
+
+	return nil
+}
+
+// validateNetworks checks vcd-network specs and vcd-primary-nic
+func (d *Driver) validateNetworks() error {
+	for _, spec := range d.Networks {
+		if _, err := client.ParseNetworkSpec(spec); err != nil {
+			return err
+		}
+	}
+
+	if d.PrimaryNIC < 0 || d.PrimaryNIC > len(d.Networks) {
+		return fmt.Errorf("invalid vcd-primary-nic %d, machine has NICs 0..%d", d.PrimaryNIC, len(d.Networks))
+	}
+
+	return nil
+}
+
+// networkConfigs returns additional NICs of the machine, specs are validated in SetConfigFromFlags
+func (d *Driver) networkConfigs() ([]client.NetworkConfig, error) {
+	networks := make([]client.NetworkConfig, 0, len(d.Networks))
+
+	for _, spec := range d.Networks {
+		network, err := client.ParseNetworkSpec(spec)
+		if err != nil {
+			return nil, err
+		}
+
+		networks = append(networks, network)
+	}
+
+	return networks, nil
+}
+
+// primaryStaticIPAddress returns IP address of the primary NIC if it's known before VM is powered on
+func (d *Driver) primaryStaticIPAddress() string {
+	if d.PrimaryNIC == 0 {
+		return d.StaticIPAddress
+	}
+
+	networks, err := d.networkConfigs()
+	if err != nil || d.PrimaryNIC > len(networks) {
+		return ""
+	}
+
+	return networks[d.PrimaryNIC-1].IPAddress
+}
+
+// primaryIPAddress returns IP address of the primary NIC reported by VCD
+func (d *Driver) primaryIPAddress(vm *govcd.VM) string {
+	if vm.VM.NetworkConnectionSection == nil {
+		return ""
+	}
+
+	for _, connection := range vm.VM.NetworkConnectionSection.NetworkConnection {
+		if connection.NetworkConnectionIndex == d.PrimaryNIC {
+			return connection.IPAddress
+		}
+	}
+
+	return ""
+}
+
+// validateSizing checks CPU topology and resource allocation flags
+func (d *Driver) validateSizing() error {
+	if d.CPUCount <= 0 {
+		return fmt.Errorf("invalid vcd-cpu-count %d", d.CPUCount)
+	}
+
+	if d.CoresPerSocket < 0 || (d.CoresPerSocket > 0 && d.CPUCount%d.CoresPerSocket != 0) {
+		return fmt.Errorf("vcd-cores-per-socket %d must divide vcd-cpu-count %d evenly", d.CoresPerSocket, d.CPUCount)
+	}
+
+	if d.CPUReservation < 0 || d.MemoryReservation < 0 {
+		return fmt.Errorf("vcd-cpu-reservation and vcd-memory-reservation can't be negative")
+	}
+
+	if d.CPULimit < -1 || d.MemoryLimit < -1 {
+		return fmt.Errorf("vcd-cpu-limit and vcd-memory-limit must be positive or -1 for unlimited")
+	}
+
+	if d.CPULimit > 0 && d.CPUReservation > d.CPULimit {
+		return fmt.Errorf("vcd-cpu-reservation %d is greater than vcd-cpu-limit %d", d.CPUReservation, d.CPULimit)
+	}
+
+	if d.MemoryReservation > d.MemorySize {
+		return fmt.Errorf("vcd-memory-reservation %d is greater than vcd-memory-size %d", d.MemoryReservation, d.MemorySize)
+	}
+
+	if d.MemoryLimit > 0 && d.MemoryReservation > d.MemoryLimit {
+		return fmt.Errorf("vcd-memory-reservation %d is greater than vcd-memory-limit %d", d.MemoryReservation, d.MemoryLimit)
+	}
+
+	if _, _, err := processor.ParseShares(d.CPUShares); err != nil {
+		return fmt.Errorf("vcd-cpu-shares: %w", err)
+	}
+
+	if _, _, err := processor.ParseShares(d.MemoryShares); err != nil {
+		return fmt.Errorf("vcd-memory-shares: %w", err)
+	}
+
+	return nil
+}
+
+// adoptSizingPolicy replaces CPU and memory of the machine with values defined by the sizing policy,
+// so stored config matches the VM
+func (d *Driver) adoptSizingPolicy(policy *types.VdcComputePolicy) {
+	if policy == nil {
+		return
+	}
+
+	if policy.CPUCount != nil && *policy.CPUCount != d.CPUCount {
+		log.Warnf("Sizing policy %s defines %d CPUs, vcd-cpu-count %d is ignored", policy.Name, *policy.CPUCount, d.CPUCount)
+		d.CPUCount = *policy.CPUCount
+	}
+
+	if policy.CoresPerSocket != nil && *policy.CoresPerSocket != d.CoresPerSocket {
+		if d.CoresPerSocket > 0 {
+			log.Warnf("Sizing policy %s defines %d cores per socket, vcd-cores-per-socket %d is ignored", policy.Name, *policy.CoresPerSocket, d.CoresPerSocket)
+		}
+		d.CoresPerSocket = *policy.CoresPerSocket
+	}
+
+	if d.CoresPerSocket > 0 && d.CPUCount%d.CoresPerSocket != 0 {
+		log.Warnf("vcd-cores-per-socket %d doesn't divide %d CPUs of sizing policy %s, all cores are in one socket", d.CoresPerSocket, d.CPUCount, policy.Name)
+		d.CoresPerSocket = 0
+	}
+
+	if policy.Memory != nil && *policy.Memory != d.MemorySize {
+		log.Warnf("Sizing policy %s defines %d MB of memory, vcd-memory-size %d is ignored", policy.Name, *policy.Memory, d.MemorySize)
+		d.MemorySize = *policy.Memory
+	}
+}
+
+// validateMandatoryParams checks params after flags and profile are merged
+// and reports all missing params at once
+func (d *Driver) validateMandatoryParams() error {
+	missing := make([]string, 0)
+
+	if !d.usesToken() {
+		if d.UserName == "" {
+			missing = append(missing, "vcd-username")
+		}
+
+		if d.UserPassword == "" && d.PasswordSource == "" {
+			missing = append(missing, "vcd-password (or vcd-password-source, vcd-api-token, vcd-token-file)")
+		}
+	}
+
+	if d.Href == "" {
+		missing = append(missing, "vcd-href")
+	}
+
+	if d.VDC == "" {
+		missing = append(missing, "vcd-vdc")
+	}
+
+	if d.Org == "" {
+		missing = append(missing, "vcd-org")
+	}
+
+	if d.StorProfile == "" {
+		missing = append(missing, "vcd-storprofile")
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("please specify vclouddirector mandatory params with options or profile: %s", strings.Join(missing, ", "))
+	}
+
 	return nil
 }
 
@@ -307,29 +997,19 @@ func (d *Driver) DriverName() string {
 func (d *Driver) GetState() (state.State, error) {
 	log.Info("GetState() running")
 
-	configVCDClient := d.buildVCDClientConfig()
-	vcdClient, err := client.NewVCloudClient(configVCDClient)
+	configVCDClient, err := d.buildVCDClientConfig()
 	if err != nil {
-		log.Errorf("Driver.GetState.NewVCloudClient error: %v", err)
+		log.Errorf("Driver.GetState.buildVCDClientConfig error: %v", err)
 		return state.Error, err
 	}
 
-	// creates Processor
-	processorConfig := processor.ConfigProcessor{
-		VAppName:       d.VAppName,
-		VMachineName:   d.BaseDriver.GetMachineName(),
-		CPUCount:       d.CPUCount,
-		MemorySize:     int64(d.MemorySize),
-		DiskSize:       int64(d.DiskSize),
-		EdgeGateway:    d.EdgeGateway,
-		PublicIP:       d.PublicIP,
-		VdcEdgeGateway: d.VdcEdgeGateway,
-		Org:            d.Org,
-		VAppID:         d.VAppID,
-		VMachineID:     d.VMachineID,
+	vcdClient, err := client.NewVCloudClient(configVCDClient)
+	if err != nil {
+		log.Errorf("Driver.GetState.NewVCloudClient error: %v", err)
+		return state.Error, err
 	}
 
-	proc := processor.NewVMProcessor(vcdClient, processorConfig)
+	proc := d.newProcessor(vcdClient)
 
 	return proc.GetState()
 }
@@ -344,7 +1024,32 @@ func (d *Driver) Create() error {
 		return errSsh
 	}
 
-	configVCDClient := d.buildVCDClientConfig()
+	authorizedKeys, err := readAuthorizedKeys(d.SSHAuthorizedKeys)
+	if err != nil {
+		log.Errorf("Create().readAuthorizedKeys error: %v", err)
+		return err
+	}
+
+	// host key of the guest is pinned, so the first SSH connection isn't trust on first use
+	hostKey, err := d.createHostKey()
+	if err != nil {
+		log.Errorf("Create().createHostKey error: %v", err)
+		return err
+	}
+
+	// templates are rendered before anything is created in VCD
+	userData, initData, err := d.renderUserData()
+	if err != nil {
+		log.Errorf("Create().renderUserData error: %v", err)
+		return err
+	}
+
+	configVCDClient, err := d.buildVCDClientConfig()
+	if err != nil {
+		log.Errorf("Create().buildVCDClientConfig error: %v", err)
+		return err
+	}
+
 	vcdClient, err := client.NewVCloudClient(configVCDClient)
 	if err != nil {
 		log.Errorf("Create().NewVCloudClient error: %v", err)
@@ -357,36 +1062,17 @@ func (d *Driver) Create() error {
 		return errBuild
 	}
 
-	log.Info("Create().VCloudClient Set up VApp before running")
+	// resolved catalog item is stored, so it's known which image the machine was built from
+	d.CatalogItemID = vcdClient.CatalogItem.CatalogItem.ID
+	d.CatalogItem = vcdClient.CatalogItem.CatalogItem.Name
 
-	// custom config for script
-	confCustom := processor.CustomScriptConfigVMProcessor{
-		VAppName:    d.VAppName,
-		MachineName: d.BaseDriver.GetMachineName(),
-		SSHKey:      sshKey,
-		SSHUser:     d.SSHUser,
-		UserData:    d.UserData,
-		InitData:    d.InitData,
-		Rke2:        d.Rke2,
-		RootAuth:    d.RootAuth,
-	}
+	d.adoptSizingPolicy(vcdClient.SizingPolicy)
 
-	// creates Processor
-	processorConfig := processor.ConfigProcessor{
-		VAppName:       d.VAppName,
-		VMachineName:   d.BaseDriver.GetMachineName(),
-		CPUCount:       d.CPUCount,
-		MemorySize:     int64(d.MemorySize),
-		DiskSize:       int64(d.DiskSize),
-		EdgeGateway:    d.EdgeGateway,
-		PublicIP:       d.PublicIP,
-		VdcEdgeGateway: d.VdcEdgeGateway,
-		Org:            d.Org,
-	}
+	log.Info("Create().VCloudClient Set up VApp before running")
 
-	proc := processor.NewVMProcessor(vcdClient, processorConfig)
+	proc := d.newProcessor(vcdClient)
 
-	vApp, errVApp := proc.Create(confCustom)
+	vApp, errVApp := proc.Create(d.buildCustomScriptConfig(sshKey, authorizedKeys, hostKey, userData, initData))
 	if errVApp != nil {
 		log.Errorf("Create.CreateVAppWithVM error: %v", errVApp)
 		return errVApp
@@ -409,20 +1095,24 @@ func (d *Driver) Create() error {
 		return errTask
 	}
 
-	for {
-		vm, errVM := vApp.GetVMByName(d.MachineName, true)
-		if errVM != nil {
-			log.Errorf("Create.GetVMByName error: %v", errVM)
-			return errVM
-		}
+	// static address of the primary NIC is known in advance, no need to wait for DHCP
+	if staticIP := d.primaryStaticIPAddress(); staticIP != "" {
+		d.PrivateIP = staticIP
+		d.VMachineID = virtualMachine.VM.ID
+	} else {
+		ip, errWait := d.waitForIPAddress(vcdClient, vApp)
+		if errWait != nil {
+			log.Errorf("Create.waitForIPAddress error: %v", errWait)
 
-		time.Sleep(2 * time.Second)
+			if errClean := proc.Cleanup(); errClean != nil {
+				log.Errorf("Create.Cleanup error: %v", errClean)
+			}
 
-		if vm.VM.NetworkConnectionSection.NetworkConnection[0].IPAddress != "" {
-			d.PrivateIP = vm.VM.NetworkConnectionSection.NetworkConnection[0].IPAddress
-			d.VMachineID = vm.VM.ID
-			break
+			return errWait
 		}
+
+		d.PrivateIP = ip
+		d.VMachineID = virtualMachine.VM.ID
 	}
 
 	d.VAppID = vApp.VApp.ID
@@ -436,36 +1126,152 @@ func (d *Driver) Create() error {
 
 	d.IPAddress = ip
 
+	if err := d.writeKnownHosts(); err != nil {
+		log.Errorf("Create.writeKnownHosts error: %v", err)
+
+		return err
+	}
+
+	// the VM is kept on failure, so the guest customization log can be inspected before docker-machine rm
+	if err := d.waitForGuestReady(vcdClient, vApp); err != nil {
+		log.Errorf("Create.waitForGuestReady error: %v", err)
+
+		return err
+	}
+
+	// a guest with a different host key is recreated or tampered with, it's removed before provisioning connects to it
+	if err := d.verifyPinnedHostKey(); err != nil {
+		log.Errorf("Create.verifyPinnedHostKey error: %v", err)
+
+		if errClean := proc.Cleanup(); errClean != nil {
+			log.Errorf("Create.Cleanup error: %v", errClean)
+		}
+
+		return err
+	}
+
+	// the guest has read its seed by the time it got an address, with static address guest tools are awaited instead
+	if d.UserDataMode == processor.UserDataModeNoCloudISO {
+		if d.primaryStaticIPAddress() != "" && d.SkipReadyWait {
+			if err := d.waitForGuestTools(vcdClient, vApp); err != nil {
+				log.Warnf("Create.waitForGuestTools error: %v", err)
+			}
+		}
+
+		if err := proc.FinishCustomization(); err != nil {
+			log.Warnf("Create.FinishCustomization error: %v", err)
+		}
+	}
+
 	return nil
 }
 
+// waitForIPAddress waits until VCD or guest tools report IP address of the primary NIC.
+// On timeout the error describes NICs and guest tools state of the VM
+func (d *Driver) waitForIPAddress(vcdClient *client.VCloudClient, vApp *govcd.VApp) (string, error) {
+	started := time.Now()
+
+	var deadline time.Time
+	if d.IPWaitTimeout > 0 {
+		deadline = started.Add(time.Duration(d.IPWaitTimeout) * time.Second)
+	}
+
+	for {
+		vm, errVM := vApp.GetVMByName(d.MachineName, true)
+		if errVM != nil {
+			log.Errorf("Create.GetVMByName error: %v", errVM)
+			return "", errVM
+		}
+
+		if ip := d.primaryIPAddress(vm); ip != "" {
+			return ip, nil
+		}
+
+		// guest tools report IP of the primary NIC in VM query when NetworkConnection has no address yet
+		vmRecord, errQuery := vcdClient.VirtualDataCenter.QueryVM(vApp.VApp.Name, d.MachineName)
+		if errQuery != nil {
+			log.Debugf("Create.QueryVM error: %v", errQuery)
+		} else if vmRecord.VM.IpAddress != "" {
+			log.Infof("Create using IP address %s reported by guest tools", vmRecord.VM.IpAddress)
+			return vmRecord.VM.IpAddress, nil
+		}
+
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			return "", fmt.Errorf("VM %s got no IP address on NIC %d in %d seconds: %s",
+				d.MachineName, d.PrimaryNIC, d.IPWaitTimeout, describeNICs(vm, vmRecord.VM))
+		}
+
+		log.Infof("Create waiting for IP address of VM %s on NIC %d. Elapsed: %s",
+			d.MachineName, d.PrimaryNIC, time.Since(started).Round(time.Second))
+
+		time.Sleep(2 * time.Second)
+	}
+}
+
+// waitForGuestTools waits up to vcd-ready-timeout until guest tools of the VM are running, so the guest OS has booted
+func (d *Driver) waitForGuestTools(vcdClient *client.VCloudClient, vApp *govcd.VApp) error {
+	started := time.Now()
+
+	for {
+		vmRecord, err := vcdClient.VirtualDataCenter.QueryVM(vApp.VApp.Name, d.MachineName)
+		if err != nil {
+			return err
+		}
+
+		switch vmRecord.VM.VmToolsStatus {
+		case "toolsOk", "toolsOld":
+			return nil
+		}
+
+		if d.ReadyTimeout > 0 && time.Since(started) > time.Duration(d.ReadyTimeout)*time.Second {
+			return fmt.Errorf("guest tools of VM %s aren't running in %d seconds, status: %q",
+				d.MachineName, d.ReadyTimeout, vmRecord.VM.VmToolsStatus)
+		}
+
+		log.Infof("Create waiting for guest tools of VM %s. Elapsed: %s", d.MachineName, time.Since(started).Round(time.Second))
+
+		time.Sleep(2 * time.Second)
+	}
+}
+
+// describeNICs returns NICs and guest tools state of the VM for diagnostics
+func describeNICs(vm *govcd.VM, vmRecord *types.QueryResultVMRecordType) string {
+	nics := make([]string, 0)
+
+	if vm.VM.NetworkConnectionSection != nil {
+		for _, connection := range vm.VM.NetworkConnectionSection.NetworkConnection {
+			nics = append(nics, fmt.Sprintf("NIC %d network %s mode %s MAC %s connected %t",
+				connection.NetworkConnectionIndex, connection.Network, connection.IPAddressAllocationMode,
+				connection.MACAddress, connection.IsConnected))
+		}
+	}
+
+	toolsStatus := "unknown"
+	if vmRecord != nil && vmRecord.VmToolsStatus != "" {
+		toolsStatus = vmRecord.VmToolsStatus
+	}
+
+	return fmt.Sprintf("%s; guest tools status: %s. Check DHCP on the network or use vcd-ip-address",
+		strings.Join(nics, ", "), toolsStatus)
+}
+
 func (d *Driver) Start() error {
 	log.Info("Start() running")
 
 	// check vcd platform state
-	configVCDClient := d.buildVCDClientConfig()
-	vcdClient, err := client.NewVCloudClient(configVCDClient)
+	configVCDClient, err := d.buildVCDClientConfig()
 	if err != nil {
-		log.Errorf("Start().NewVCloudClient error: %v", err)
+		log.Errorf("Start().buildVCDClientConfig error: %v", err)
 		return err
 	}
 
-	// creates Processor
-	processorConfig := processor.ConfigProcessor{
-		VAppName:       d.VAppName,
-		VMachineName:   d.BaseDriver.GetMachineName(),
-		CPUCount:       d.CPUCount,
-		MemorySize:     int64(d.MemorySize),
-		DiskSize:       int64(d.DiskSize),
-		EdgeGateway:    d.EdgeGateway,
-		PublicIP:       d.PublicIP,
-		VdcEdgeGateway: d.VdcEdgeGateway,
-		Org:            d.Org,
-		VAppID:         d.VAppID,
-		VMachineID:     d.VMachineID,
+	vcdClient, err := client.NewVCloudClient(configVCDClient)
+	if err != nil {
+		log.Errorf("Start().NewVCloudClient error: %v", err)
+		return err
 	}
 
-	proc := processor.NewVMProcessor(vcdClient, processorConfig)
+	proc := d.newProcessor(vcdClient)
 
 	if err := proc.Start(); err != nil {
 		log.Errorf("Kill error: %v", err)
@@ -484,7 +1290,12 @@ func (d *Driver) Start() error {
 func (d *Driver) Stop() error {
 	log.Info("Stop() running")
 
-	configVCDClient := d.buildVCDClientConfig()
+	configVCDClient, err := d.buildVCDClientConfig()
+	if err != nil {
+		log.Errorf("Stop.buildVCDClientConfig error: %v", err)
+		return err
+	}
+
 	vcdClient, err := client.NewVCloudClient(configVCDClient)
 	if err != nil {
 		log.Errorf("Stop.NewVCloudClient error %v", err)
@@ -493,22 +1304,7 @@ func (d *Driver) Stop() error {
 
 	log.Info("Stop.VCloudClient.getVDCApp")
 
-	// creates Processor
-	processorConfig := processor.ConfigProcessor{
-		VAppName:       d.VAppName,
-		VMachineName:   d.BaseDriver.GetMachineName(),
-		CPUCount:       d.CPUCount,
-		MemorySize:     int64(d.MemorySize),
-		DiskSize:       int64(d.DiskSize),
-		EdgeGateway:    d.EdgeGateway,
-		PublicIP:       d.PublicIP,
-		VdcEdgeGateway: d.VdcEdgeGateway,
-		Org:            d.Org,
-		VAppID:         d.VAppID,
-		VMachineID:     d.VMachineID,
-	}
-
-	proc := processor.NewVMProcessor(vcdClient, processorConfig)
+	proc := d.newProcessor(vcdClient)
 	if err := proc.Stop(); err != nil {
 		log.Errorf("Stop error: %v", err)
 		return err
@@ -520,7 +1316,13 @@ func (d *Driver) Stop() error {
 func (d *Driver) Restart() error {
 	log.Info("Restart() running")
 
-	vcdClient, err := client.NewVCloudClient(d.buildVCDClientConfig())
+	configVCDClient, err := d.buildVCDClientConfig()
+	if err != nil {
+		log.Errorf("Restart.buildVCDClientConfig error %v", err)
+		return err
+	}
+
+	vcdClient, err := client.NewVCloudClient(configVCDClient)
 	if err != nil {
 		log.Errorf("Restart.NewVCloudClient error %v", err)
 		return err
@@ -528,22 +1330,7 @@ func (d *Driver) Restart() error {
 
 	log.Info("Restart.VCloudClient create new processor")
 
-	// creates Processor
-	processorConfig := processor.ConfigProcessor{
-		VAppName:       d.VAppName,
-		VMachineName:   d.BaseDriver.GetMachineName(),
-		CPUCount:       d.CPUCount,
-		MemorySize:     int64(d.MemorySize),
-		DiskSize:       int64(d.DiskSize),
-		EdgeGateway:    d.EdgeGateway,
-		PublicIP:       d.PublicIP,
-		VdcEdgeGateway: d.VdcEdgeGateway,
-		Org:            d.Org,
-		VAppID:         d.VAppID,
-		VMachineID:     d.VMachineID,
-	}
-
-	proc := processor.NewVMProcessor(vcdClient, processorConfig)
+	proc := d.newProcessor(vcdClient)
 	if err := proc.Restart(); err != nil {
 		log.Errorf("Stop error: %v", err)
 		return err
@@ -555,39 +1342,19 @@ func (d *Driver) Restart() error {
 func (d *Driver) Remove() error {
 	log.Info("Remove() running")
 
-	configVCDClient := d.buildVCDClientConfig()
-	vcdClient, err := client.NewVCloudClient(configVCDClient)
+	configVCDClient, err := d.buildVCDClientConfig()
 	if err != nil {
-		log.Errorf("Remove.NewVCloudClient error: %v", err)
+		log.Errorf("Remove.buildVCDClientConfig error: %v", err)
 		return err
 	}
 
-	// creates Processor
-	processorConfig := processor.ConfigProcessor{
-		VAppName:       d.VAppName,
-		VMachineName:   d.BaseDriver.GetMachineName(),
-		CPUCount:       d.CPUCount,
-		MemorySize:     int64(d.MemorySize),
-		DiskSize:       int64(d.DiskSize),
-		EdgeGateway:    d.EdgeGateway,
-		PublicIP:       d.PublicIP,
-		VdcEdgeGateway: d.VdcEdgeGateway,
-		Org:            d.Org,
-		VAppID:         d.VAppID,
-		VMachineID:     d.VMachineID,
+	vcdClient, err := client.NewVCloudClient(configVCDClient)
+	if err != nil {
+		log.Errorf("Remove.NewVCloudClient error: %v", err)
+		return err
 	}
 
-	var proc processor.Processor
-
-	// if VMachineID is empty, it's a VApp
-	if processorConfig.VMachineID == "" {
-		processorConfig.VAppName = d.MachineName
-		processorConfig.VMachineName = d.MachineName
-
-		proc = processor.NewVAppProcessor(vcdClient, processorConfig)
-	} else {
-		proc = processor.NewVMProcessor(vcdClient, processorConfig)
-	}
+	proc := d.newProcessor(vcdClient)
 
 	if err := proc.Remove(); err != nil {
 		log.Errorf("Remove error: %v", err)
@@ -600,35 +1367,19 @@ func (d *Driver) Remove() error {
 func (d *Driver) Kill() error {
 	log.Info("Kill() running")
 
-	configVCDClient := d.buildVCDClientConfig()
-	vcdClient, err := client.NewVCloudClient(configVCDClient)
+	configVCDClient, err := d.buildVCDClientConfig()
 	if err != nil {
-		log.Errorf("Kill.NewVCloudClient error: %v", err)
+		log.Errorf("Kill.buildVCDClientConfig error: %v", err)
 		return err
 	}
 
-	// creates Processor
-	processorConfig := processor.ConfigProcessor{
-		VAppName:       d.VAppName,
-		VMachineName:   d.BaseDriver.GetMachineName(),
-		CPUCount:       d.CPUCount,
-		MemorySize:     int64(d.MemorySize),
-		DiskSize:       int64(d.DiskSize),
-		EdgeGateway:    d.EdgeGateway,
-		PublicIP:       d.PublicIP,
-		VdcEdgeGateway: d.VdcEdgeGateway,
-		Org:            d.Org,
-		VAppID:         d.VAppID,
-		VMachineID:     d.VMachineID,
+	vcdClient, err := client.NewVCloudClient(configVCDClient)
+	if err != nil {
+		log.Errorf("Kill.NewVCloudClient error: %v", err)
+		return err
 	}
 
-	var proc processor.Processor
-
-	if processorConfig.VMachineID == "" {
-		proc = processor.NewVAppProcessor(vcdClient, processorConfig)
-	} else {
-		proc = processor.NewVMProcessor(vcdClient, processorConfig)
-	}
+	proc := d.newProcessor(vcdClient)
 
 	if err := proc.Kill(); err != nil {
 		log.Errorf("Kill error: %v", err)
@@ -640,7 +1391,18 @@ func (d *Driver) Kill() error {
 	return nil
 }
 
+// createSSHKey generates key pair of the machine or installs key pair of vcd-ssh-key-path, returns the public key
 func (d *Driver) createSSHKey() (string, error) {
+	if d.SSHKeySourcePath != "" {
+		publicKey, err := d.installSSHKeyPair()
+		if err != nil {
+			log.Errorf("createSSHKey.installSSHKeyPair error: %s", err)
+			return "", err
+		}
+
+		return publicKey, nil
+	}
+
 	if err := ssh.GenerateSSHKey(d.GetSSHKeyPath()); err != nil {
 		log.Errorf("createSSHKey.GenerateSSHKey error: %s", err)
 		return "", err
@@ -655,20 +1417,211 @@ func (d *Driver) createSSHKey() (string, error) {
 	return string(publicKey), nil
 }
 
-func (d *Driver) buildVCDClientConfig() client.ConfigClient {
+// buildVCDClientConfig creates client config. Passwords are resolved from credential sources at call time
+func (d *Driver) buildVCDClientConfig() (client.ConfigClient, error) {
+	password, err := d.resolvePassword()
+	if err != nil {
+		return client.ConfigClient{}, err
+	}
+
+	proxyURL, err := d.resolveProxyURL()
+	if err != nil {
+		return client.ConfigClient{}, err
+	}
+
+	networks, err := d.networkConfigs()
+	if err != nil {
+		return client.ConfigClient{}, err
+	}
+
 	return client.ConfigClient{
 		MachineName:             d.MachineName,
 		UserName:                d.UserName,
-		UserPassword:            d.UserPassword,
+		UserPassword:            password,
+		APIToken:                d.APIToken,
+		TokenFile:               d.TokenFile,
 		Org:                     d.Org,
 		VDC:                     d.VDC,
 		OrgVDCNet:               d.OrgVDCNet,
 		Catalog:                 d.Catalog,
 		CatalogItem:             d.CatalogItem,
+		CatalogItemID:           d.CatalogItemID,
+		CatalogItemMatch:        d.CatalogItemMatch,
+		CatalogItemLatest:       d.CatalogItemLatest,
+		TemplateVM:              d.TemplateVM,
+		TemplateSource:          d.TemplateSource,
 		StorProfile:             d.StorProfile,
 		AdapterType:             d.AdapterType,
 		IPAddressAllocationMode: d.IPAddressAllocationMode,
+		IPAddress:               d.StaticIPAddress,
+		Networks:                networks,
+		PrimaryNIC:              d.PrimaryNIC,
+		SizingPolicy:            d.SizingPolicy,
+		PlacementPolicy:         d.PlacementPolicy,
 		Url:                     d.Url,
 		Insecure:                d.Insecure,
+		CACert:                  d.CACert,
+		TLSFingerprint:          d.TLSFingerprint,
+		ProxyURL:                proxyURL,
+		NoProxy:                 d.NoProxy,
+		SessionCacheDir:         d.sessionCacheDir(),
+		SessionTTL:              time.Duration(d.SessionTTL) * time.Minute,
+	}, nil
+}
+
+// NewVCloudClient connects to VCD with the machine config, it's used by vcd-tool
+func (d *Driver) NewVCloudClient() (*client.VCloudClient, error) {
+	configVCDClient, err := d.buildVCDClientConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return client.NewVCloudClient(configVCDClient)
+}
+
+// sessionCacheDir returns directory in docker-machine store where VCD sessions are shared between machines
+func (d *Driver) sessionCacheDir() string {
+	if d.NoSessionCache || d.StorePath == "" {
+		return ""
+	}
+
+	return filepath.Join(d.StorePath, sessionCacheDirName)
+}
+
+// usesToken returns true if machine authenticates with API token or token file instead of password
+func (d *Driver) usesToken() bool {
+	return d.APIToken != "" || d.TokenFile != ""
+}
+
+// getProcessorMode returns stored processor mode.
+// Machines created before vcd-processor-mode was introduced have no stored mode:
+// if VMachineID is empty, it's a VApp
+func (d *Driver) getProcessorMode() string {
+	if d.ProcessorMode != "" {
+		return d.ProcessorMode
+	}
+
+	if d.VMachineID == "" {
+		return processorModeVApp
+	}
+
+	return processorModeVM
+}
+
+func (d *Driver) buildProcessorConfig() processor.ConfigProcessor {
+	processorConfig := processor.ConfigProcessor{
+		VAppName:             d.VAppName,
+		VMachineName:         d.BaseDriver.GetMachineName(),
+		CPUCount:             d.CPUCount,
+		CoresPerSocket:       d.CoresPerSocket,
+		CPUReservation:       int64(d.CPUReservation),
+		CPULimit:             int64(d.CPULimit),
+		CPUShares:            d.CPUShares,
+		CPUHotAdd:            d.CPUHotAdd,
+		MemorySize:           int64(d.MemorySize),
+		MemoryReservation:    int64(d.MemoryReservation),
+		MemoryLimit:          int64(d.MemoryLimit),
+		MemoryShares:         d.MemoryShares,
+		MemoryHotAdd:         d.MemoryHotAdd,
+		DiskSize:             int64(d.DiskSize),
+		DataDisks:            d.dataDisks(),
+		PersistentDisk:       d.persistentDisk(),
+		DeletePersistentDisk: d.DeletePersistentDisk,
+		UserDataMode:         d.UserDataMode,
+		Bootstrap: processor.BootstrapConfig{
+			Distro:              d.BootstrapDistro,
+			DisablePasswordAuth: d.SSHDisablePasswordAuth,
+			DisableRootLogin:    d.SSHDisableRootLogin,
+		},
+		Catalog:        d.Catalog,
+		EdgeGateway:    d.EdgeGateway,
+		PublicIP:       d.PublicIP,
+		VdcEdgeGateway: d.VdcEdgeGateway,
+		Org:            d.Org,
+		VAppID:         d.VAppID,
+		VMachineID:     d.VMachineID,
+	}
+
+	// VAppProcessor works with vApp and VM with the same name as machine
+	if d.getProcessorMode() == processorModeVApp {
+		processorConfig.VAppName = d.MachineName
+		processorConfig.VMachineName = d.MachineName
+	}
+
+	return processorConfig
+}
+
+// dataDisks returns additional disks of the machine, specs are validated in SetConfigFromFlags
+func (d *Driver) dataDisks() []processor.DataDisk {
+	disks := make([]processor.DataDisk, 0, len(d.DataDisks))
+
+	for _, spec := range d.DataDisks {
+		disk, err := processor.ParseDataDiskSpec(spec)
+		if err != nil {
+			log.Warnf("dataDisks skips %v", err)
+			continue
+		}
+
+		disks = append(disks, disk)
+	}
+
+	return disks
+}
+
+// persistentDisk returns named independent disk of the machine, spec is validated in SetConfigFromFlags
+func (d *Driver) persistentDisk() processor.PersistentDisk {
+	if d.PersistentDisk == "" {
+		return processor.PersistentDisk{}
+	}
+
+	disk, err := processor.ParsePersistentDiskSpec(d.PersistentDisk)
+	if err != nil {
+		log.Warnf("persistentDisk skips %v", err)
+		return processor.PersistentDisk{}
+	}
+
+	return disk
+}
+
+// newProcessor creates Processor according to the processor mode of the machine
+func (d *Driver) newProcessor(vcdClient *client.VCloudClient) processor.Processor {
+	processorConfig := d.buildProcessorConfig()
+
+	if d.getProcessorMode() == processorModeVApp {
+		return processor.NewVAppProcessor(vcdClient, processorConfig)
+	}
+
+	return processor.NewVMProcessor(vcdClient, processorConfig)
+}
+
+// buildCustomScriptConfig creates custom script config for the processor of the machine with rendered user data
+func (d *Driver) buildCustomScriptConfig(sshKey string, authorizedKeys []string, hostKey hostKeyPair, userData, initData string) interface{} {
+	if d.getProcessorMode() == processorModeVApp {
+		return processor.CustomScriptConfigVAppProcessor{
+			VAppName:       d.MachineName,
+			SSHKey:         sshKey,
+			AuthorizedKeys: authorizedKeys,
+			HostPrivateKey: hostKey.PrivateKey,
+			HostPublicKey:  hostKey.PublicKey,
+			SSHUser:        d.SSHUser,
+			UserData:       userData,
+			InitData:       initData,
+			Rke2:           d.Rke2,
+			RootAuth:       d.RootAuth,
+		}
+	}
+
+	return processor.CustomScriptConfigVMProcessor{
+		VAppName:       d.VAppName,
+		MachineName:    d.BaseDriver.GetMachineName(),
+		SSHKey:         sshKey,
+		AuthorizedKeys: authorizedKeys,
+		HostPrivateKey: hostKey.PrivateKey,
+		HostPublicKey:  hostKey.PublicKey,
+		SSHUser:        d.SSHUser,
+		UserData:       userData,
+		InitData:       initData,
+		Rke2:           d.Rke2,
+		RootAuth:       d.RootAuth,
 	}
 }
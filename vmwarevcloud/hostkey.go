@@ -0,0 +1,244 @@
+package vmwarevcloud
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/machine/libmachine/log"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// files of the pinned guest host key in the machine directory
+const (
+	hostPublicKeyFileName   = "ssh_host_ed25519_key.pub"
+	hostFingerprintFileName = "ssh_host_ed25519_key.fingerprint"
+	knownHostsFileName      = "known_hosts"
+)
+
+const hostKeyVerifyTimeout = 10 * time.Second
+
+// errHostKeyMismatch is returned when the guest presents a host key different from the pinned one
+var errHostKeyMismatch = errors.New("host key mismatch")
+
+// hostKeyPair is the guest host key generated by the driver
+type hostKeyPair struct {
+	PrivateKey string
+	PublicKey  string
+}
+
+// createHostKey generates ed25519 host key of the guest. Public key and its fingerprint are stored
+// in the machine directory, the private key is only passed to the guest
+func (d *Driver) createHostKey() (hostKeyPair, error) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return hostKeyPair{}, fmt.Errorf("createHostKey.GenerateKey error: %w", err)
+	}
+
+	sshPublicKey, err := ssh.NewPublicKey(publicKey)
+	if err != nil {
+		return hostKeyPair{}, fmt.Errorf("createHostKey.NewPublicKey error: %w", err)
+	}
+
+	privatePEM, err := marshalED25519PrivateKey(privateKey, "root@"+d.MachineName)
+	if err != nil {
+		return hostKeyPair{}, err
+	}
+
+	authorizedKey := ssh.MarshalAuthorizedKey(sshPublicKey)
+	fingerprint := ssh.FingerprintSHA256(sshPublicKey)
+
+	if err := os.WriteFile(d.ResolveStorePath(hostPublicKeyFileName), authorizedKey, 0644); err != nil {
+		return hostKeyPair{}, fmt.Errorf("createHostKey.WriteFile error: %w", err)
+	}
+
+	if err := os.WriteFile(d.ResolveStorePath(hostFingerprintFileName), []byte(fingerprint+"\n"), 0644); err != nil {
+		return hostKeyPair{}, fmt.Errorf("createHostKey.WriteFile error: %w", err)
+	}
+
+	d.HostKeyFingerprint = fingerprint
+
+	return hostKeyPair{PrivateKey: string(privatePEM), PublicKey: string(authorizedKey)}, nil
+}
+
+// hostPublicKey returns pinned host key of the guest
+func (d *Driver) hostPublicKey() (ssh.PublicKey, error) {
+	content, err := os.ReadFile(d.ResolveStorePath(hostPublicKeyFileName))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("machine %s has no pinned host key", d.MachineName)
+		}
+
+		return nil, fmt.Errorf("hostPublicKey.ReadFile error: %w", err)
+	}
+
+	publicKey, _, _, _, err := ssh.ParseAuthorizedKey(content)
+	if err != nil {
+		return nil, fmt.Errorf("hostPublicKey.ParseAuthorizedKey error: %w", err)
+	}
+
+	return publicKey, nil
+}
+
+// hostKeyAddress returns SSH address of the machine
+func (d *Driver) hostKeyAddress() (string, error) {
+	ip, err := d.GetSSHHostname()
+	if err != nil {
+		return "", err
+	}
+
+	if ip == "" {
+		return "", fmt.Errorf("machine %s has no IP address", d.MachineName)
+	}
+
+	return net.JoinHostPort(ip, strconv.Itoa(d.SSHPort)), nil
+}
+
+// KnownHostsEntry returns known_hosts line of the machine address with the pinned host key
+func (d *Driver) KnownHostsEntry() (string, error) {
+	publicKey, err := d.hostPublicKey()
+	if err != nil {
+		return "", err
+	}
+
+	address, err := d.hostKeyAddress()
+	if err != nil {
+		return "", err
+	}
+
+	return knownhosts.Line([]string{knownhosts.Normalize(address)}, publicKey), nil
+}
+
+// writeKnownHosts writes known_hosts file of the machine, use it with ssh -o UserKnownHostsFile
+func (d *Driver) writeKnownHosts() error {
+	entry, err := d.KnownHostsEntry()
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(d.ResolveStorePath(knownHostsFileName), []byte(entry+"\n"), 0644); err != nil {
+		return fmt.Errorf("writeKnownHosts.WriteFile error: %w", err)
+	}
+
+	return nil
+}
+
+// VerifyHostKey connects to SSH port of the machine and checks that the guest presents the pinned host key
+func (d *Driver) VerifyHostKey() error {
+	publicKey, err := d.hostPublicKey()
+	if err != nil {
+		return err
+	}
+
+	address, err := d.hostKeyAddress()
+	if err != nil {
+		return err
+	}
+
+	var (
+		checked  bool
+		presents ssh.PublicKey
+	)
+
+	config := &ssh.ClientConfig{
+		User:              d.GetSSHUsername(),
+		HostKeyAlgorithms: []string{ssh.KeyAlgoED25519},
+		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			checked = true
+			presents = key
+
+			if !bytes.Equal(key.Marshal(), publicKey.Marshal()) {
+				return errHostKeyMismatch
+			}
+
+			return nil
+		},
+		Timeout: hostKeyVerifyTimeout,
+	}
+
+	// no auth method is offered, the connection fails after the host key check
+	connection, err := ssh.Dial("tcp", address, config)
+	if err == nil {
+		connection.Close()
+	}
+
+	switch {
+	case !checked && err != nil && strings.Contains(err.Error(), "no common algorithm for host key"):
+		return fmt.Errorf("%s doesn't offer %s host key, the guest image may not support it: %w", address, ssh.KeyAlgoED25519, err)
+	case !checked:
+		return fmt.Errorf("host key of %s wasn't received: %w", address, err)
+	case !bytes.Equal(presents.Marshal(), publicKey.Marshal()):
+		return fmt.Errorf("%w: %s presents host key %s, pinned host key of machine %s is %s: the guest was recreated or tampered with",
+			errHostKeyMismatch, address, ssh.FingerprintSHA256(presents), d.MachineName, ssh.FingerprintSHA256(publicKey))
+	}
+
+	log.Debugf("VerifyHostKey %s presents pinned host key %s", address, ssh.FingerprintSHA256(publicKey))
+
+	return nil
+}
+
+// marshalED25519PrivateKey encodes ed25519 key in unencrypted OpenSSH private key format of sshd host keys
+func marshalED25519PrivateKey(privateKey ed25519.PrivateKey, comment string) ([]byte, error) {
+	publicKey, err := ssh.NewPublicKey(privateKey.Public())
+	if err != nil {
+		return nil, fmt.Errorf("marshalED25519PrivateKey.NewPublicKey error: %w", err)
+	}
+
+	check := make([]byte, 4)
+	if _, err := rand.Read(check); err != nil {
+		return nil, fmt.Errorf("marshalED25519PrivateKey.Read error: %w", err)
+	}
+
+	checkInt := binary.BigEndian.Uint32(check)
+
+	section := struct {
+		Check1  uint32
+		Check2  uint32
+		KeyType string
+		Public  []byte
+		Private []byte
+		Comment string
+		Pad     []byte `ssh:"rest"`
+	}{
+		Check1:  checkInt,
+		Check2:  checkInt,
+		KeyType: ssh.KeyAlgoED25519,
+		Public:  privateKey.Public().(ed25519.PublicKey),
+		Private: privateKey,
+		Comment: comment,
+	}
+
+	// unencrypted section is padded to the cipher block size of 8 with bytes 1, 2, 3...
+	for i := 1; len(ssh.Marshal(section))%8 != 0; i++ {
+		section.Pad = append(section.Pad, byte(i))
+	}
+
+	envelope := struct {
+		CipherName   string
+		KdfName      string
+		KdfOptions   string
+		NumKeys      uint32
+		PublicKey    []byte
+		PrivateBlock []byte
+	}{
+		CipherName:   "none",
+		KdfName:      "none",
+		NumKeys:      1,
+		PublicKey:    publicKey.Marshal(),
+		PrivateBlock: ssh.Marshal(section),
+	}
+
+	data := append([]byte("openssh-key-v1\x00"), ssh.Marshal(envelope)...)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "OPENSSH PRIVATE KEY", Bytes: data}), nil
+}
@@ -0,0 +1,315 @@
+package vmwarevcloud
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/docker/machine/libmachine/drivers"
+	rpcdriver "github.com/docker/machine/libmachine/drivers/rpc"
+	"github.com/docker/machine/libmachine/mcnflag"
+	"gopkg.in/yaml.v2"
+)
+
+// profilesFile is a YAML file with named profiles. Profile keys are flag names without vcd- prefix:
+//
+//	profiles:
+//	  prod:
+//	    href: https://vcd.example.com/api
+//	    org: my-org
+//	    vdc: my-vdc
+//	    storprofile: ssd
+type profilesFile struct {
+	Profiles map[string]map[string]interface{} `yaml:"profiles"`
+}
+
+// profileOptions fills flags which were not set explicitly with values of the profile.
+// Flag is set if its key is in the flag map. docker-machine create fills the map with defaults of all flags,
+// for such map a flag is considered as not set if its value equals the flag default
+type profileOptions struct {
+	drivers.DriverOptions
+	profile  map[string]interface{}
+	defaults map[string]interface{}
+	values   map[string]interface{}
+}
+
+// loadProfile reads profile by name from configFile
+func loadProfile(configFile, name string) (map[string]interface{}, error) {
+	content, err := os.ReadFile(configFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read vcd config file: %w", err)
+	}
+
+	var file profilesFile
+	if err := yaml.Unmarshal(content, &file); err != nil {
+		return nil, fmt.Errorf("unable to parse vcd config file %s: %w", configFile, err)
+	}
+
+	profile, ok := file.Profiles[name]
+	if !ok {
+		names := make([]string, 0, len(file.Profiles))
+		for profileName := range file.Profiles {
+			names = append(names, profileName)
+		}
+
+		return nil, fmt.Errorf("profile %q not found in %s, available profiles: %s", name, configFile, strings.Join(names, ", "))
+	}
+
+	return profile, nil
+}
+
+// defaultConfigFile returns vcd-profiles.yml path in docker-machine store
+func (d *Driver) defaultConfigFile() string {
+	if d.StorePath != "" {
+		return filepath.Join(d.StorePath, defaultConfigFileName)
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return defaultConfigFileName
+	}
+
+	return filepath.Join(home, ".docker", "machine", defaultConfigFileName)
+}
+
+// withProfile returns flags merged with the profile from vcd-profile and vcd-config-file
+func (d *Driver) withProfile(flags drivers.DriverOptions) (drivers.DriverOptions, error) {
+	d.Profile = flags.String("vcd-profile")
+	d.ConfigFile = flags.String("vcd-config-file")
+
+	if d.Profile == "" {
+		return flags, nil
+	}
+
+	if d.ConfigFile == "" {
+		d.ConfigFile = d.defaultConfigFile()
+	}
+
+	profile, err := loadProfile(d.ConfigFile, d.Profile)
+	if err != nil {
+		return nil, err
+	}
+
+	defaults := make(map[string]interface{})
+	for _, flag := range d.GetCreateFlags() {
+		defaults[flag.String()] = flag.Default()
+	}
+
+	typed, err := convertProfile(d.Profile, profile, d.GetCreateFlags())
+	if err != nil {
+		return nil, err
+	}
+
+	return profileOptions{
+		DriverOptions: flags,
+		profile:       typed,
+		defaults:      defaults,
+		values:        flagValues(flags, defaults),
+	}, nil
+}
+
+// convertProfile converts profile values to types of their flags. Unknown keys and values
+// which don't match the flag type are rejected, so typos aren't silently ignored
+func convertProfile(name string, profile map[string]interface{}, flags []mcnflag.Flag) (map[string]interface{}, error) {
+	flagsByKey := make(map[string]mcnflag.Flag, len(flags))
+	for _, flag := range flags {
+		flagsByKey[strings.TrimPrefix(flag.String(), "vcd-")] = flag
+	}
+
+	unknown := make([]string, 0)
+	typed := make(map[string]interface{}, len(profile))
+
+	for key, value := range profile {
+		flag, ok := flagsByKey[key]
+		if !ok {
+			unknown = append(unknown, key)
+			continue
+		}
+
+		if value == nil {
+			continue
+		}
+
+		converted, err := convertProfileValue(flag, value)
+		if err != nil {
+			return nil, fmt.Errorf("profile %q key %s: %w", name, key, err)
+		}
+
+		typed[key] = converted
+	}
+
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+
+		return nil, fmt.Errorf("profile %q has unknown keys: %s (keys are flag names without vcd- prefix)", name, strings.Join(unknown, ", "))
+	}
+
+	return typed, nil
+}
+
+// convertProfileValue converts YAML value to string, int, bool or []string of the flag
+func convertProfileValue(flag mcnflag.Flag, value interface{}) (interface{}, error) {
+	switch flag.(type) {
+	case mcnflag.IntFlag:
+		switch typed := value.(type) {
+		case int:
+			return typed, nil
+		case string:
+			parsed, err := strconv.Atoi(strings.TrimSpace(typed))
+			if err != nil {
+				return nil, fmt.Errorf("expected integer, got %q", typed)
+			}
+
+			return parsed, nil
+		}
+
+		return nil, fmt.Errorf("expected integer, got %v", value)
+	case mcnflag.BoolFlag:
+		switch typed := value.(type) {
+		case bool:
+			return typed, nil
+		case string:
+			parsed, err := strconv.ParseBool(strings.TrimSpace(typed))
+			if err != nil {
+				return nil, fmt.Errorf("expected true or false, got %q", typed)
+			}
+
+			return parsed, nil
+		}
+
+		return nil, fmt.Errorf("expected true or false, got %v", value)
+	case mcnflag.StringSliceFlag:
+		items, ok := value.([]interface{})
+		if !ok {
+			items = []interface{}{value}
+		}
+
+		values := make([]string, 0, len(items))
+		for _, item := range items {
+			converted, err := profileScalar(item)
+			if err != nil {
+				return nil, err
+			}
+
+			values = append(values, converted)
+		}
+
+		return values, nil
+	}
+
+	return profileScalar(value)
+}
+
+// profileScalar returns YAML scalar as string, lists and maps are rejected
+func profileScalar(value interface{}) (string, error) {
+	switch value.(type) {
+	case string, int, int64, float64, bool:
+		return fmt.Sprint(value), nil
+	}
+
+	return "", fmt.Errorf("expected a single value, got %v", value)
+}
+
+// flagValues returns the map of user supplied flags, nil if flags carry values of all flags
+func flagValues(flags drivers.DriverOptions, defaults map[string]interface{}) map[string]interface{} {
+	var values map[string]interface{}
+
+	switch typed := flags.(type) {
+	case rpcdriver.RPCFlags:
+		values = typed.Values
+	case *rpcdriver.RPCFlags:
+		values = typed.Values
+	default:
+		return nil
+	}
+
+	for key := range defaults {
+		if _, ok := values[key]; !ok {
+			return values
+		}
+	}
+
+	return nil
+}
+
+func (o profileOptions) lookup(key string) (interface{}, bool) {
+	value, ok := o.profile[strings.TrimPrefix(key, "vcd-")]
+
+	return value, ok
+}
+
+// explicit returns the flag value and whether it was set explicitly, unset flag has its default value.
+// When flags carry values of all flags, a value different from the flag default is explicit
+func (o profileOptions) explicit(key string, get func(string) interface{}) (interface{}, bool) {
+	if o.values == nil {
+		value := get(key)
+
+		return value, !isDefaultValue(value, o.defaults[key])
+	}
+
+	if _, ok := o.values[key]; !ok {
+		return o.defaults[key], false
+	}
+
+	return get(key), true
+}
+
+// isDefaultValue compares flag value with its default. Bool flags have no default, it's false
+func isDefaultValue(value, defaultValue interface{}) bool {
+	switch typed := value.(type) {
+	case bool:
+		return !typed
+	case []string:
+		return len(typed) == 0
+	}
+
+	return reflect.DeepEqual(value, defaultValue)
+}
+
+func (o profileOptions) String(key string) string {
+	value, set := o.explicit(key, func(key string) interface{} { return o.DriverOptions.String(key) })
+	result, _ := value.(string)
+
+	if profileValue, ok := o.lookup(key); ok && !set {
+		result, _ = profileValue.(string)
+	}
+
+	return result
+}
+
+func (o profileOptions) StringSlice(key string) []string {
+	value, set := o.explicit(key, func(key string) interface{} { return o.DriverOptions.StringSlice(key) })
+	result, _ := value.([]string)
+
+	if profileValue, ok := o.lookup(key); ok && !set {
+		result, _ = profileValue.([]string)
+	}
+
+	return result
+}
+
+func (o profileOptions) Int(key string) int {
+	value, set := o.explicit(key, func(key string) interface{} { return o.DriverOptions.Int(key) })
+	result, _ := value.(int)
+
+	if profileValue, ok := o.lookup(key); ok && !set {
+		result, _ = profileValue.(int)
+	}
+
+	return result
+}
+
+func (o profileOptions) Bool(key string) bool {
+	value, set := o.explicit(key, func(key string) interface{} { return o.DriverOptions.Bool(key) })
+	result, _ := value.(bool)
+
+	if profileValue, ok := o.lookup(key); ok && !set {
+		result, _ = profileValue.(bool)
+	}
+
+	return result
+}
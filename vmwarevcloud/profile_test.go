@@ -0,0 +1,182 @@
+package vmwarevcloud
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	rpcdriver "github.com/docker/machine/libmachine/drivers/rpc"
+)
+
+const testProfile = `profiles:
+  test:
+    cpu-count: 4
+    memory-size: "4096"
+    insecure: true
+    org: profile-org
+    network: [storage, backup]
+`
+
+// writeProfile writes vcd-profiles.yml with the content and returns its path
+func writeProfile(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), defaultConfigFileName)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("WriteFile error: %v", err)
+	}
+
+	return path
+}
+
+// allFlags returns flags like docker-machine create passes them: defaults of all flags with values on top
+func allFlags(d *Driver, values map[string]interface{}) rpcdriver.RPCFlags {
+	flags := rpcdriver.RPCFlags{Values: make(map[string]interface{})}
+
+	for _, flag := range d.GetCreateFlags() {
+		flags.Values[flag.String()] = flag.Default()
+		if flag.Default() == nil {
+			flags.Values[flag.String()] = false
+		}
+	}
+
+	for key, value := range values {
+		flags.Values[key] = value
+	}
+
+	return flags
+}
+
+func TestProfilePrecedence(t *testing.T) {
+	configFile := writeProfile(t, testProfile)
+	profileFlags := map[string]interface{}{"vcd-profile": "test", "vcd-config-file": configFile}
+
+	withFlags := func(values map[string]interface{}) map[string]interface{} {
+		merged := map[string]interface{}{}
+		for key, value := range profileFlags {
+			merged[key] = value
+		}
+
+		for key, value := range values {
+			merged[key] = value
+		}
+
+		return merged
+	}
+
+	tests := []struct {
+		name          string
+		all           bool
+		values        map[string]interface{}
+		cpuCount      int
+		memorySize    int
+		diskSize      int
+		insecure      bool
+		org           string
+		networks      []string
+		processorMode string
+	}{
+		{
+			name:     "partial map takes unset flags from profile",
+			values:   withFlags(nil),
+			cpuCount: 4, memorySize: 4096, diskSize: defaultDisk, insecure: true, org: "profile-org",
+			networks: []string{"storage", "backup"}, processorMode: defaultProcessorMode,
+		},
+		{
+			name: "partial map explicit flags equal to defaults override profile",
+			values: withFlags(map[string]interface{}{
+				"vcd-cpu-count": defaultCpus, "vcd-insecure": false, "vcd-org": "", "vcd-network": []string{},
+			}),
+			cpuCount: defaultCpus, memorySize: 4096, diskSize: defaultDisk, insecure: false, org: "",
+			networks: []string{}, processorMode: defaultProcessorMode,
+		},
+		{
+			name:     "full map takes flags with default values from profile",
+			all:      true,
+			values:   profileFlags,
+			cpuCount: 4, memorySize: 4096, diskSize: defaultDisk, insecure: true, org: "profile-org",
+			networks: []string{"storage", "backup"}, processorMode: defaultProcessorMode,
+		},
+		{
+			name:     "full map explicit values override profile",
+			all:      true,
+			values:   withFlags(map[string]interface{}{"vcd-cpu-count": 8, "vcd-org": "flag-org", "vcd-network": []string{"front"}}),
+			cpuCount: 8, memorySize: 4096, diskSize: defaultDisk, insecure: true, org: "flag-org",
+			networks: []string{"front"}, processorMode: defaultProcessorMode,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d := NewDriver("machine", t.TempDir()).(*Driver)
+
+			flags := rpcdriver.RPCFlags{Values: test.values}
+			if test.all {
+				flags = allFlags(d, test.values)
+			}
+
+			options, err := d.withProfile(flags)
+			if err != nil {
+				t.Fatalf("withProfile error: %v", err)
+			}
+
+			if got := options.Int("vcd-cpu-count"); got != test.cpuCount {
+				t.Errorf("vcd-cpu-count = %d, want %d", got, test.cpuCount)
+			}
+
+			if got := options.Int("vcd-memory-size"); got != test.memorySize {
+				t.Errorf("vcd-memory-size = %d, want %d", got, test.memorySize)
+			}
+
+			if got := options.Int("vcd-disk-size"); got != test.diskSize {
+				t.Errorf("vcd-disk-size = %d, want %d", got, test.diskSize)
+			}
+
+			if got := options.Bool("vcd-insecure"); got != test.insecure {
+				t.Errorf("vcd-insecure = %v, want %v", got, test.insecure)
+			}
+
+			if got := options.String("vcd-org"); got != test.org {
+				t.Errorf("vcd-org = %q, want %q", got, test.org)
+			}
+
+			if got := options.StringSlice("vcd-network"); !reflect.DeepEqual(got, test.networks) {
+				t.Errorf("vcd-network = %v, want %v", got, test.networks)
+			}
+
+			if got := options.String("vcd-processor-mode"); got != test.processorMode {
+				t.Errorf("vcd-processor-mode = %q, want %q", got, test.processorMode)
+			}
+		})
+	}
+}
+
+func TestProfileInvalidValues(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile string
+		err     string
+	}{
+		{name: "int with suffix", profile: `cpu-count: "4x"`, err: "cpu-count"},
+		{name: "fractional int", profile: `cpu-count: 2.5`, err: "cpu-count"},
+		{name: "quoted yes bool", profile: `insecure: "yes"`, err: "insecure"},
+		{name: "list for string", profile: `org: [a, b]`, err: "org"},
+		{name: "unknown key", profile: `cpucount: 4`, err: "unknown keys: cpucount"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			configFile := writeProfile(t, "profiles:\n  test:\n    "+test.profile+"\n")
+			d := NewDriver("machine", t.TempDir()).(*Driver)
+
+			_, err := d.withProfile(rpcdriver.RPCFlags{Values: map[string]interface{}{
+				"vcd-profile": "test", "vcd-config-file": configFile,
+			}})
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("withProfile error = %v, want error with %q", err, test.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package vmwarevcloud
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/DimKush/docker-driver-vcd/client"
+	"github.com/DimKush/docker-driver-vcd/processor"
+	"github.com/docker/machine/libmachine/log"
+	"github.com/vmware/go-vcloud-director/v2/govcd"
+)
+
+// guest customization statuses of VCD VM
+const (
+	guestCustomizationPending     = "GC_PENDING"
+	guestCustomizationPostPending = "POST_GC_PENDING"
+	guestCustomizationComplete    = "GC_COMPLETE"
+	guestCustomizationFailed      = "GC_FAILED"
+)
+
+const (
+	guestReadyPollInterval = 5 * time.Second
+	sshPortDialTimeout     = 5 * time.Second
+)
+
+// waitForGuestReady waits until guest tools of the VM are running and its guest customization is complete,
+// with vcd-wait-ssh also until SSH port accepts connections. Failed guest customization is an error
+func (d *Driver) waitForGuestReady(vcdClient *client.VCloudClient, vApp *govcd.VApp) error {
+	if d.SkipReadyWait {
+		return nil
+	}
+
+	started := time.Now()
+
+	var deadline time.Time
+	if d.ReadyTimeout > 0 {
+		deadline = started.Add(time.Duration(d.ReadyTimeout) * time.Second)
+	}
+
+	vm, err := vApp.GetVMByName(d.MachineName, true)
+	if err != nil {
+		return fmt.Errorf("waitForGuestReady.GetVMByName error: %w", err)
+	}
+
+	// cloud-init modes deliver user data without guest customization
+	section := vm.VM.GuestCustomizationSection
+	waitCustomization := d.UserDataMode == processor.UserDataModeCustomization &&
+		section != nil && section.Enabled != nil && *section.Enabled
+
+	customizationStatus := "not used"
+
+	for {
+		vmRecord, err := vcdClient.VirtualDataCenter.QueryVM(vApp.VApp.Name, d.MachineName)
+		if err != nil {
+			return fmt.Errorf("waitForGuestReady.QueryVM error: %w", err)
+		}
+
+		toolsStatus := vmRecord.VM.VmToolsStatus
+		toolsReady := toolsStatus == "toolsOk" || toolsStatus == "toolsOld"
+
+		customizationReady := true
+
+		if waitCustomization {
+			customizationStatus, err = vm.GetGuestCustomizationStatus()
+			if err != nil {
+				return fmt.Errorf("waitForGuestReady.GetGuestCustomizationStatus error: %w", err)
+			}
+
+			switch customizationStatus {
+			case guestCustomizationFailed:
+				return fmt.Errorf("guest customization of VM %s failed (%s), the customization script log is in /var/log/vmware-imc of the guest",
+					d.MachineName, guestCustomizationFailed)
+			case guestCustomizationPending, guestCustomizationPostPending:
+				customizationReady = false
+			}
+		}
+
+		if toolsReady && customizationReady {
+			break
+		}
+
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			return fmt.Errorf("VM %s isn't ready in %d seconds: guest tools status %q, guest customization status %s",
+				d.MachineName, d.ReadyTimeout, toolsStatus, customizationStatus)
+		}
+
+		log.Infof("Create waiting for guest tools (%s) and guest customization (%s) of VM %s. Elapsed: %s",
+			toolsStatus, customizationStatus, d.MachineName, time.Since(started).Round(time.Second))
+
+		time.Sleep(guestReadyPollInterval)
+	}
+
+	log.Infof("Create VM %s is ready, guest customization status: %s", d.MachineName, customizationStatus)
+
+	if !d.WaitSSH {
+		return nil
+	}
+
+	return d.waitForSSHPort(deadline)
+}
+
+// waitForSSHPort waits until SSH port of the machine accepts TCP connections, zero deadline waits endlessly
+func (d *Driver) waitForSSHPort(deadline time.Time) error {
+	address, err := d.hostKeyAddress()
+	if err != nil {
+		return err
+	}
+
+	for {
+		connection, err := net.DialTimeout("tcp", address, sshPortDialTimeout)
+		if err == nil {
+			connection.Close()
+			return nil
+		}
+
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			return fmt.Errorf("SSH port %s of VM %s doesn't accept connections: %w", address, d.MachineName, err)
+		}
+
+		log.Infof("Create waiting for SSH port %s of VM %s: %v", address, d.MachineName, err)
+
+		time.Sleep(guestReadyPollInterval)
+	}
+}
+
+// verifyPinnedHostKey checks that the guest presents the pinned host key before docker-machine provisioning
+// connects to it without checking the key. Only a different key is an error: the check is skipped with
+// vcd-skip-ready-wait, and a guest whose SSH port isn't reachable yet or which doesn't offer ed25519 host keys
+// (older images) is only reported, the key can be checked later with vcd-tool known-hosts -verify
+func (d *Driver) verifyPinnedHostKey() error {
+	if d.SkipReadyWait {
+		log.Infof("Create doesn't check pinned host key of VM %s with vcd-skip-ready-wait", d.MachineName)
+		return nil
+	}
+
+	err := d.VerifyHostKey()
+	if err == nil || errors.Is(err, errHostKeyMismatch) {
+		return err
+	}
+
+	log.Warnf("Create couldn't check pinned host key of VM %s, check it with vcd-tool known-hosts -verify: %v", d.MachineName, err)
+
+	return nil
+}
@@ -0,0 +1,167 @@
+package vmwarevcloud
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// serveSSH starts SSH server with the host key on localhost, which accepts handshakes and rejects
+// any authentication, and returns its port
+func serveSSH(t *testing.T, hostKey ssh.Signer) int {
+	t.Helper()
+
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(ssh.ConnMetadata, ssh.PublicKey) (*ssh.Permissions, error) {
+			return nil, errors.New("denied")
+		},
+	}
+	config.AddHostKey(hostKey)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen error: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			connection, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer connection.Close()
+				_, _, _, _ = ssh.NewServerConn(connection, config)
+			}()
+		}
+	}()
+
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+// closedPort returns a localhost port nothing listens on
+func closedPort(t *testing.T) int {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen error: %v", err)
+	}
+
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	return port
+}
+
+func TestVerifyPinnedHostKey(t *testing.T) {
+	_, otherED25519, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey error: %v", err)
+	}
+
+	otherSigner, err := ssh.NewSignerFromKey(otherED25519)
+	if err != nil {
+		t.Fatalf("NewSignerFromKey error: %v", err)
+	}
+
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey error: %v", err)
+	}
+
+	ecdsaSigner, err := ssh.NewSignerFromKey(ecdsaKey)
+	if err != nil {
+		t.Fatalf("NewSignerFromKey error: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		server    func(pinned ssh.Signer) int
+		skipReady bool
+		mismatch  bool
+	}{
+		{name: "pinned key", server: func(pinned ssh.Signer) int { return serveSSH(t, pinned) }},
+		{name: "different key fails", server: func(ssh.Signer) int { return serveSSH(t, otherSigner) }, mismatch: true},
+		{name: "no ed25519 host key is a warning", server: func(ssh.Signer) int { return serveSSH(t, ecdsaSigner) }},
+		{name: "unreachable port is a warning", server: func(ssh.Signer) int { return closedPort(t) }},
+		{name: "skip ready wait doesn't connect", server: func(ssh.Signer) int { return serveSSH(t, otherSigner) }, skipReady: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d := NewDriver("machine", t.TempDir()).(*Driver)
+			d.SkipReadyWait = test.skipReady
+
+			if err := os.MkdirAll(d.ResolveStorePath("."), 0700); err != nil {
+				t.Fatalf("MkdirAll error: %v", err)
+			}
+
+			hostKey, err := d.createHostKey()
+			if err != nil {
+				t.Fatalf("createHostKey error: %v", err)
+			}
+
+			pinned, err := ssh.ParsePrivateKey([]byte(hostKey.PrivateKey))
+			if err != nil {
+				t.Fatalf("ParsePrivateKey error: %v", err)
+			}
+
+			d.PrivateIP = "127.0.0.1"
+			d.SSHPort = test.server(pinned)
+
+			err = d.verifyPinnedHostKey()
+
+			if test.mismatch {
+				if !errors.Is(err, errHostKeyMismatch) {
+					t.Fatalf("verifyPinnedHostKey error = %v, want host key mismatch", err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("verifyPinnedHostKey error on port %d: %v", d.SSHPort, err)
+			}
+		})
+	}
+}
+
+func TestVerifyHostKeyWithoutED25519(t *testing.T) {
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey error: %v", err)
+	}
+
+	ecdsaSigner, err := ssh.NewSignerFromKey(ecdsaKey)
+	if err != nil {
+		t.Fatalf("NewSignerFromKey error: %v", err)
+	}
+
+	d := NewDriver("machine", t.TempDir()).(*Driver)
+	if err := os.MkdirAll(d.ResolveStorePath("."), 0700); err != nil {
+		t.Fatalf("MkdirAll error: %v", err)
+	}
+
+	if _, err := d.createHostKey(); err != nil {
+		t.Fatalf("createHostKey error: %v", err)
+	}
+
+	d.PrivateIP = "127.0.0.1"
+	d.SSHPort = serveSSH(t, ecdsaSigner)
+
+	err = d.VerifyHostKey()
+	if err == nil || errors.Is(err, errHostKeyMismatch) || !strings.Contains(err.Error(), "doesn't offer ssh-ed25519 host key") {
+		t.Fatalf("VerifyHostKey error = %v, want error about missing ed25519 host key", err)
+	}
+}
@@ -0,0 +1,107 @@
+package vmwarevcloud
+
+import (
+	"fmt"
+
+	"github.com/docker/machine/libmachine/drivers"
+	"github.com/docker/machine/libmachine/log"
+)
+
+// growRootFilesystemScript rescans disks and grows partition and filesystem of "/" to the end of the disk.
+// Root on a partition and root on LVM with a single physical volume are supported
+const growRootFilesystemScript = `set -e
+SUDO=""
+[ "$(id -u)" -eq 0 ] || SUDO=sudo
+for rescan in /sys/class/block/*/device/rescan; do echo 1 | $SUDO tee "$rescan" >/dev/null; done
+source=$(findmnt -n -o SOURCE /)
+fstype=$(findmnt -n -o FSTYPE /)
+part="$source"
+if [ "$(lsblk -n -d -o TYPE "$source")" = "lvm" ]; then
+  vg=$($SUDO lvs --noheadings -o vg_name "$source" | tr -d ' ')
+  part=$($SUDO pvs --noheadings -o pv_name -S vg_name="$vg" | head -n 1 | tr -d ' ')
+fi
+disk=/dev/$(lsblk -n -d -o PKNAME "$part")
+number=$(cat "/sys/class/block/$(basename "$(readlink -f "$part")")/partition")
+$SUDO growpart "$disk" "$number" || [ $? -eq 1 ]
+if [ "$part" != "$source" ]; then
+  $SUDO pvresize "$part"
+  $SUDO lvextend -r -l +100%FREE "$source" || true
+  exit 0
+fi
+case "$fstype" in
+  ext2|ext3|ext4) $SUDO resize2fs "$source" ;;
+  xfs) $SUDO xfs_growfs / ;;
+  btrfs) $SUDO btrfs filesystem resize max / ;;
+  *) echo "unsupported root filesystem $fstype" >&2; exit 1 ;;
+esac
+`
+
+// ResizeSpec is a new size of the machine, zero values keep the current size
+type ResizeSpec struct {
+	CPUCount       int
+	CoresPerSocket int
+	MemorySize     int
+	DiskSize       int
+}
+
+// Resize changes CPU, memory and OS disk size of existing machine and updates stored config on success.
+// VM is powered off only if the change can't be hot added
+func (d *Driver) Resize(spec ResizeSpec) error {
+	previous := *d
+
+	if spec.CPUCount > 0 {
+		d.CPUCount = spec.CPUCount
+	}
+
+	if spec.CoresPerSocket > 0 {
+		d.CoresPerSocket = spec.CoresPerSocket
+	}
+
+	if spec.MemorySize > 0 {
+		d.MemorySize = spec.MemorySize
+	}
+
+	if spec.DiskSize > 0 {
+		d.DiskSize = spec.DiskSize
+	}
+
+	restore := func(err error) error {
+		*d = previous
+		return err
+	}
+
+	if d.SizingPolicy != "" && (d.CPUCount != previous.CPUCount || d.CoresPerSocket != previous.CoresPerSocket || d.MemorySize != previous.MemorySize) {
+		return restore(fmt.Errorf("CPU and memory of machine %s are defined by sizing policy %s", d.MachineName, d.SizingPolicy))
+	}
+
+	if d.DiskSize < previous.DiskSize {
+		return restore(fmt.Errorf("disk of machine %s can't shrink from %d MB to %d MB", d.MachineName, previous.DiskSize, d.DiskSize))
+	}
+
+	if err := d.validateSizing(); err != nil {
+		return restore(err)
+	}
+
+	vcdClient, err := d.NewVCloudClient()
+	if err != nil {
+		log.Errorf("Resize.NewVCloudClient error: %v", err)
+		return restore(err)
+	}
+
+	if err := d.newProcessor(vcdClient).Resize(); err != nil {
+		log.Errorf("Resize.Processor.Resize error: %v", err)
+		return restore(err)
+	}
+
+	return nil
+}
+
+// GrowRootFilesystem grows root partition and filesystem of running machine over SSH after disk resize
+func (d *Driver) GrowRootFilesystem() (string, error) {
+	output, err := drivers.RunSSHCommandFromDriver(d, growRootFilesystemScript)
+	if err != nil {
+		return output, fmt.Errorf("GrowRootFilesystem of machine %s error: %w", d.MachineName, err)
+	}
+
+	return output, nil
+}
@@ -0,0 +1,110 @@
+package vmwarevcloud
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// loadSSHKeyPair parses private key of vcd-ssh-key-path and returns its public key in authorized_keys format.
+// If the key has a .pub file next to it, both keys must match
+func loadSSHKeyPair(path string) ([]byte, string, error) {
+	privateKey, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", fmt.Errorf("vcd-ssh-key-path: %w", err)
+	}
+
+	signer, err := ssh.ParsePrivateKey(privateKey)
+	if err != nil {
+		var passphraseErr *ssh.PassphraseMissingError
+		if errors.As(err, &passphraseErr) {
+			return nil, "", fmt.Errorf("vcd-ssh-key-path %s is encrypted, docker-machine needs a key without passphrase", path)
+		}
+
+		return nil, "", fmt.Errorf("vcd-ssh-key-path %s isn't a private key: %w", path, err)
+	}
+
+	publicKey := signer.PublicKey()
+
+	storedPublicKey, err := os.ReadFile(path + ".pub")
+	switch {
+	case err == nil:
+		parsed, _, _, _, errParse := ssh.ParseAuthorizedKey(storedPublicKey)
+		if errParse != nil {
+			return nil, "", fmt.Errorf("invalid public key %s.pub: %w", path, errParse)
+		}
+
+		if !bytes.Equal(parsed.Marshal(), publicKey.Marshal()) {
+			return nil, "", fmt.Errorf("public key %s.pub (%s) doesn't match private key %s (%s)",
+				path, ssh.FingerprintSHA256(parsed), path, ssh.FingerprintSHA256(publicKey))
+		}
+
+		return privateKey, strings.TrimSpace(string(storedPublicKey)) + "\n", nil
+	case errors.Is(err, os.ErrNotExist):
+		return privateKey, string(ssh.MarshalAuthorizedKey(publicKey)), nil
+	default:
+		return nil, "", fmt.Errorf("reading public key %s.pub error: %w", path, err)
+	}
+}
+
+// readAuthorizedKeys returns keys of vcd-ssh-authorized-key values. A value is a file with
+// authorized_keys lines or a literal key
+func readAuthorizedKeys(values []string) ([]string, error) {
+	keys := make([]string, 0, len(values))
+
+	for _, value := range values {
+		lines := []string{value}
+
+		if info, err := os.Stat(value); err == nil && info.Mode().IsRegular() {
+			content, errRead := os.ReadFile(value)
+			if errRead != nil {
+				return nil, fmt.Errorf("vcd-ssh-authorized-key: %w", errRead)
+			}
+
+			lines = lines[:0]
+
+			scanner := bufio.NewScanner(bytes.NewReader(content))
+			for scanner.Scan() {
+				lines = append(lines, scanner.Text())
+			}
+		}
+
+		for _, line := range lines {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+
+			if _, _, _, _, err := ssh.ParseAuthorizedKey([]byte(line)); err != nil {
+				return nil, fmt.Errorf("invalid vcd-ssh-authorized-key %q: %w", line, err)
+			}
+
+			keys = append(keys, line)
+		}
+	}
+
+	return keys, nil
+}
+
+// installSSHKeyPair copies key pair of vcd-ssh-key-path to the machine directory, where docker-machine expects it
+func (d *Driver) installSSHKeyPair() (string, error) {
+	privateKey, publicKey, err := loadSSHKeyPair(d.SSHKeySourcePath)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.WriteFile(d.GetSSHKeyPath(), privateKey, 0600); err != nil {
+		return "", fmt.Errorf("installSSHKeyPair.WriteFile error: %w", err)
+	}
+
+	if err := os.WriteFile(d.GetSSHKeyPath()+".pub", []byte(publicKey), 0644); err != nil {
+		return "", fmt.Errorf("installSSHKeyPair.WriteFile error: %w", err)
+	}
+
+	return publicKey, nil
+}
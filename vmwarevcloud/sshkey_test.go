@@ -0,0 +1,164 @@
+package vmwarevcloud
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// testKeyPair generates ed25519 key pair, returns private key in OpenSSH format and authorized_keys line
+func testKeyPair(t *testing.T, comment string) ([]byte, string) {
+	t.Helper()
+
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey error: %v", err)
+	}
+
+	privatePEM, err := marshalED25519PrivateKey(privateKey, comment)
+	if err != nil {
+		t.Fatalf("marshalED25519PrivateKey error: %v", err)
+	}
+
+	publicKey, err := ssh.NewPublicKey(privateKey.Public())
+	if err != nil {
+		t.Fatalf("NewPublicKey error: %v", err)
+	}
+
+	authorizedKey := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(publicKey)))
+	if comment != "" {
+		authorizedKey += " " + comment
+	}
+
+	return privatePEM, authorizedKey
+}
+
+// writeTestFile writes content to name in dir and returns its path
+func writeTestFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("WriteFile error: %v", err)
+	}
+
+	return path
+}
+
+func TestLoadSSHKeyPair(t *testing.T) {
+	privateKey, publicKey := testKeyPair(t, "ops@example.com")
+	_, otherPublicKey := testKeyPair(t, "")
+
+	tests := []struct {
+		name       string
+		privateKey string
+		publicKey  *string
+		want       string
+		err        string
+	}{
+		{name: "matching pub file is kept with comment", privateKey: string(privateKey), publicKey: &publicKey, want: publicKey + "\n"},
+		{name: "missing pub file derives public key", privateKey: string(privateKey), want: strings.TrimSuffix(publicKey, " ops@example.com") + "\n"},
+		{name: "mismatched pub file", privateKey: string(privateKey), publicKey: &otherPublicKey, err: "doesn't match private key"},
+		{name: "invalid pub file", privateKey: string(privateKey), publicKey: stringPtr("ssh-ed25519 not-base64"), err: "invalid public key"},
+		{name: "invalid private key", privateKey: "not a key", err: "isn't a private key"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := writeTestFile(t, dir, "id_ed25519", test.privateKey)
+
+			if test.publicKey != nil {
+				writeTestFile(t, dir, "id_ed25519.pub", *test.publicKey+"\n")
+			}
+
+			gotPrivateKey, gotPublicKey, err := loadSSHKeyPair(path)
+
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("loadSSHKeyPair error = %v, want error with %q", err, test.err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("loadSSHKeyPair error: %v", err)
+			}
+
+			if string(gotPrivateKey) != test.privateKey {
+				t.Errorf("private key isn't returned as read")
+			}
+
+			if gotPublicKey != test.want {
+				t.Errorf("public key = %q, want %q", gotPublicKey, test.want)
+			}
+		})
+	}
+
+	t.Run("missing private key", func(t *testing.T) {
+		if _, _, err := loadSSHKeyPair(filepath.Join(t.TempDir(), "id_ed25519")); err == nil {
+			t.Fatal("expected error for missing private key")
+		}
+	})
+}
+
+func TestReadAuthorizedKeys(t *testing.T) {
+	_, first := testKeyPair(t, "first@example.com")
+	_, second := testKeyPair(t, "")
+	_, literal := testKeyPair(t, "literal")
+
+	dir := t.TempDir()
+	keysFile := writeTestFile(t, dir, "authorized_keys", "# team keys\n\n"+first+"\n  "+second+"  \n")
+
+	tests := []struct {
+		name   string
+		values []string
+		want   []string
+		err    string
+	}{
+		{name: "file with comments and blank lines", values: []string{keysFile}, want: []string{first, second}},
+		{name: "literal key", values: []string{literal}, want: []string{literal}},
+		{name: "file and literal", values: []string{literal, keysFile}, want: []string{literal, first, second}},
+		{name: "missing file is a literal", values: []string{filepath.Join(dir, "missing")}, err: "invalid vcd-ssh-authorized-key"},
+		{name: "directory is a literal", values: []string{dir}, err: "invalid vcd-ssh-authorized-key"},
+		{name: "invalid literal", values: []string{"ssh-ed25519 not-base64"}, err: "invalid vcd-ssh-authorized-key"},
+		{
+			name:   "invalid line in file",
+			values: []string{writeTestFile(t, dir, "broken_keys", first+"\nnot a key\n")},
+			err:    `invalid vcd-ssh-authorized-key "not a key"`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := readAuthorizedKeys(test.values)
+
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("readAuthorizedKeys error = %v, want error with %q", err, test.err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("readAuthorizedKeys error: %v", err)
+			}
+
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("readAuthorizedKeys = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func stringPtr(value string) *string {
+	return &value
+}
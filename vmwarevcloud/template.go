@@ -0,0 +1,151 @@
+package vmwarevcloud
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// template rendering of vcd-user-data and vcd-init-data by vcd-template-mode
+const (
+	templateModeNone   = "none"
+	templateModeRender = "render"
+	templateModeStrict = "strict"
+)
+
+// renderedUserDataFileName is a file in the machine directory with rendered rke2 user data
+const renderedUserDataFileName = "user-data.rendered"
+
+// userDataTemplateData is available in templates of user data and init data, e.g. {{ .MachineName }} or {{ .Vars.role }}
+type userDataTemplateData struct {
+	MachineName string
+	VAppName    string
+	SSHUser     string
+	Org         string
+	VDC         string
+	Network     string
+	Vars        map[string]string
+}
+
+// parseTemplateVars parses vcd-template-var values key=value
+func parseTemplateVars(specs []string) (map[string]string, error) {
+	vars := make(map[string]string, len(specs))
+
+	for _, spec := range specs {
+		parts := strings.SplitN(spec, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("invalid vcd-template-var %q, expected key=value", spec)
+		}
+
+		key := strings.TrimSpace(parts[0])
+		if _, ok := vars[key]; ok {
+			return nil, fmt.Errorf("vcd-template-var %s is set more than once", key)
+		}
+
+		vars[key] = parts[1]
+	}
+
+	return vars, nil
+}
+
+// renderTemplate executes text as Go template. In strict mode a reference to undefined variable is an error,
+// otherwise it's rendered as empty string
+func renderTemplate(name, text string, data userDataTemplateData, strict bool) (string, error) {
+	missingKey := "missingkey=zero"
+	if strict {
+		missingKey = "missingkey=error"
+	}
+
+	tmpl, err := template.New(name).Option(missingKey).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid template in %s: %w", name, err)
+	}
+
+	var rendered bytes.Buffer
+	if err := tmpl.Execute(&rendered, data); err != nil {
+		return "", fmt.Errorf("rendering %s error: %w", name, err)
+	}
+
+	return rendered.String(), nil
+}
+
+// templateData returns values of the machine available in user data templates
+func (d *Driver) templateData() (userDataTemplateData, error) {
+	vars, err := parseTemplateVars(d.TemplateVars)
+	if err != nil {
+		return userDataTemplateData{}, err
+	}
+
+	data := userDataTemplateData{
+		MachineName: d.MachineName,
+		VAppName:    d.VAppName,
+		SSHUser:     d.SSHUser,
+		Org:         d.Org,
+		VDC:         d.VDC,
+		Network:     d.OrgVDCNet,
+		Vars:        vars,
+	}
+
+	if d.getProcessorMode() == processorModeVApp {
+		data.VAppName = d.MachineName
+	}
+
+	if d.PrimaryNIC > 0 {
+		networks, err := d.networkConfigs()
+		if err != nil {
+			return userDataTemplateData{}, err
+		}
+
+		data.Network = networks[d.PrimaryNIC-1].Name
+	}
+
+	return data, nil
+}
+
+// renderUserData returns user data and init data of the machine rendered by vcd-template-mode.
+// With rke2 user data is a file, the rendered copy is written to the machine directory and its path is returned
+func (d *Driver) renderUserData() (string, string, error) {
+	if d.TemplateMode == "" || d.TemplateMode == templateModeNone {
+		return d.UserData, d.InitData, nil
+	}
+
+	data, err := d.templateData()
+	if err != nil {
+		return "", "", err
+	}
+
+	strict := d.TemplateMode == templateModeStrict
+
+	initData, err := renderTemplate("vcd-init-data", d.InitData, data, strict)
+	if err != nil {
+		return "", "", err
+	}
+
+	if !d.Rke2 {
+		userData, err := renderTemplate("vcd-user-data", d.UserData, data, strict)
+		if err != nil {
+			return "", "", err
+		}
+
+		return userData, initData, nil
+	}
+
+	source, err := os.ReadFile(d.UserData)
+	if err != nil {
+		return "", "", fmt.Errorf("renderUserData.ReadFile error: %w", err)
+	}
+
+	userData, err := renderTemplate("vcd-user-data", string(source), data, strict)
+	if err != nil {
+		return "", "", err
+	}
+
+	renderedPath := d.ResolveStorePath(renderedUserDataFileName)
+	if err := os.WriteFile(renderedPath, []byte(userData), 0600); err != nil {
+		return "", "", fmt.Errorf("renderUserData.WriteFile error: %w", err)
+	}
+
+	return renderedPath, initData, nil
+}
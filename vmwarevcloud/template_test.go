@@ -0,0 +1,168 @@
+package vmwarevcloud
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	data := userDataTemplateData{
+		MachineName: "worker-1",
+		Vars:        map[string]string{"role": "worker"},
+	}
+
+	tests := []struct {
+		name   string
+		text   string
+		strict bool
+		want   string
+		err    string
+	}{
+		{name: "render defined values", text: "{{ .MachineName }}:{{ .Vars.role }}", want: "worker-1:worker"},
+		{name: "strict defined values", text: "{{ .MachineName }}:{{ .Vars.role }}", strict: true, want: "worker-1:worker"},
+		{name: "render missing var is empty", text: "role={{ .Vars.zone }};", want: "role=;"},
+		{name: "strict missing var fails", text: "role={{ .Vars.zone }};", strict: true, err: `map has no entry for key "zone"`},
+		{name: "render unknown field fails", text: "{{ .Cluster }}", err: "can't evaluate field Cluster"},
+		{name: "invalid template", text: "{{ .MachineName ", err: "invalid template in vcd-user-data"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := renderTemplate("vcd-user-data", test.text, data, test.strict)
+
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("renderTemplate error = %v, want error with %q", err, test.err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("renderTemplate error: %v", err)
+			}
+
+			if got != test.want {
+				t.Errorf("renderTemplate = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseTemplateVars(t *testing.T) {
+	vars, err := parseTemplateVars([]string{"role=worker", " zone =a=b", "empty="})
+	if err != nil {
+		t.Fatalf("parseTemplateVars error: %v", err)
+	}
+
+	want := map[string]string{"role": "worker", "zone": "a=b", "empty": ""}
+	for key, value := range want {
+		if vars[key] != value {
+			t.Errorf("vars[%q] = %q, want %q", key, vars[key], value)
+		}
+	}
+
+	for _, specs := range [][]string{{"role"}, {"=worker"}, {"role=a", "role=b"}} {
+		if _, err := parseTemplateVars(specs); err == nil {
+			t.Errorf("parseTemplateVars(%q) expected error", specs)
+		}
+	}
+}
+
+func TestRenderUserDataModes(t *testing.T) {
+	const (
+		userData = "#cloud-config\nhostname: {{ .MachineName }}\nrole: {{ .Vars.role }}\n"
+		initData = "echo {{ .SSHUser }}"
+	)
+
+	tests := []struct {
+		name     string
+		mode     string
+		vars     []string
+		userData string
+		initData string
+		err      string
+	}{
+		{name: "empty mode keeps templates", userData: userData, initData: initData},
+		{name: "none keeps templates", mode: templateModeNone, userData: userData, initData: initData},
+		{
+			name: "render renders missing var as empty", mode: templateModeRender,
+			userData: "#cloud-config\nhostname: machine\nrole: \n", initData: "echo docker",
+		},
+		{name: "strict fails on missing var", mode: templateModeStrict, err: `map has no entry for key "role"`},
+		{
+			name: "strict renders defined var", mode: templateModeStrict, vars: []string{"role=worker"},
+			userData: "#cloud-config\nhostname: machine\nrole: worker\n", initData: "echo docker",
+		},
+		{name: "invalid var", mode: templateModeRender, vars: []string{"role"}, err: "invalid vcd-template-var"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d := NewDriver("machine", t.TempDir()).(*Driver)
+			d.SSHUser = "docker"
+			d.UserData = userData
+			d.InitData = initData
+			d.TemplateMode = test.mode
+			d.TemplateVars = test.vars
+
+			gotUserData, gotInitData, err := d.renderUserData()
+
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("renderUserData error = %v, want error with %q", err, test.err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("renderUserData error: %v", err)
+			}
+
+			if gotUserData != test.userData {
+				t.Errorf("user data = %q, want %q", gotUserData, test.userData)
+			}
+
+			if gotInitData != test.initData {
+				t.Errorf("init data = %q, want %q", gotInitData, test.initData)
+			}
+		})
+	}
+}
+
+func TestRenderUserDataRke2File(t *testing.T) {
+	d := NewDriver("machine", t.TempDir()).(*Driver)
+	d.Rke2 = true
+	d.TemplateMode = templateModeStrict
+	d.TemplateVars = []string{"token=secret"}
+
+	if err := os.MkdirAll(d.ResolveStorePath("."), 0700); err != nil {
+		t.Fatalf("MkdirAll error: %v", err)
+	}
+
+	d.UserData = filepath.Join(t.TempDir(), "rke2.sh")
+	if err := os.WriteFile(d.UserData, []byte("TOKEN={{ .Vars.token }}\n"), 0600); err != nil {
+		t.Fatalf("WriteFile error: %v", err)
+	}
+
+	renderedPath, _, err := d.renderUserData()
+	if err != nil {
+		t.Fatalf("renderUserData error: %v", err)
+	}
+
+	if renderedPath != d.ResolveStorePath(renderedUserDataFileName) {
+		t.Errorf("rendered path = %q, want the machine directory", renderedPath)
+	}
+
+	rendered, err := os.ReadFile(renderedPath)
+	if err != nil {
+		t.Fatalf("ReadFile error: %v", err)
+	}
+
+	if string(rendered) != "TOKEN=secret\n" {
+		t.Errorf("rendered user data = %q", rendered)
+	}
+}